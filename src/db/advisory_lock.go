@@ -0,0 +1,182 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrLockNotAcquired is returned when an advisory lock is held elsewhere for longer
+// than the caller was willing to wait.
+var ErrLockNotAcquired = errors.New("advisory lock not acquired")
+
+// ErrLockLost is returned by Unlock and AdvisoryLock.Err once the connection holding the
+// lock has died; MySQL releases a connection's locks when it closes, so another
+// process may have taken the lock since.
+var ErrLockLost = errors.New("advisory lock lost")
+
+// lockKeepaliveInterval is how often a held lock's connection is pinged.
+var lockKeepaliveInterval = 5 * time.Second
+
+// maxLockNameLength is the longest lock name MySQL accepts.
+const maxLockNameLength = 64
+
+// AdvisoryLock is a named MySQL lock taken with GET_LOCK. It pins the connection it was
+// taken on until Unlock, pinging it in the background to notice when it dies.
+type AdvisoryLock struct {
+	name     string
+	conn     *sql.Conn
+	lost     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+	mu       sync.Mutex
+	err      error
+	unlocked bool
+}
+
+// AcquireLock takes the advisory lock name on a dedicated connection, waiting up to
+// timeout for it to be released elsewhere; a negative timeout waits forever. MySQL
+// counts the timeout in whole seconds, so it is rounded up. It returns
+// ErrLockNotAcquired if the lock stayed held.
+func (r *RDSPooledConnection) AcquireLock(ctx context.Context, name string, timeout time.Duration) (*AdvisoryLock, error) {
+	if name == "" || len(name) > maxLockNameLength {
+		return nil, fmt.Errorf("invalid lock name %q: must be 1-%d characters", name, maxLockNameLength)
+	}
+
+	conn, err := r.cnxPool.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+
+	seconds := int64(-1)
+	if timeout >= 0 {
+		seconds = int64(math.Ceil(timeout.Seconds()))
+	}
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", name, seconds).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to acquire lock %s: %w", name, err)
+	}
+	if !acquired.Valid || acquired.Int64 != 1 {
+		conn.Close()
+		return nil, fmt.Errorf("%w: %s", ErrLockNotAcquired, name)
+	}
+
+	lock := &AdvisoryLock{
+		name: name,
+		conn: conn,
+		lost: make(chan struct{}),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go lock.keepalive()
+	return lock, nil
+}
+
+// keepalive pings the lock's connection until Unlock, marking the lock lost if a ping fails.
+func (l *AdvisoryLock) keepalive() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(lockKeepaliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), lockKeepaliveInterval)
+			err := l.conn.PingContext(ctx)
+			cancel()
+			if err != nil {
+				l.mu.Lock()
+				l.err = fmt.Errorf("%w: %s: %w", ErrLockLost, l.name, err)
+				l.mu.Unlock()
+				close(l.lost)
+				return
+			}
+		}
+	}
+}
+
+// Name returns the name the lock was acquired with.
+func (l *AdvisoryLock) Name() string {
+	return l.name
+}
+
+// Lost returns a channel that is closed when the lock is found to be lost.
+func (l *AdvisoryLock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Err returns an error matching ErrLockLost if the lock has been lost, or nil.
+func (l *AdvisoryLock) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.err
+}
+
+// Unlock releases the lock with RELEASE_LOCK and returns its connection to the pool.
+// It returns an error matching ErrLockLost if the lock was lost while held. Calling
+// Unlock again does nothing.
+func (l *AdvisoryLock) Unlock() error {
+	l.mu.Lock()
+	if l.unlocked {
+		l.mu.Unlock()
+		return nil
+	}
+	l.unlocked = true
+	l.mu.Unlock()
+
+	close(l.stop)
+	<-l.done
+	defer l.conn.Close()
+
+	if err := l.Err(); err != nil {
+		return err
+	}
+
+	var released sql.NullInt64
+	if err := l.conn.QueryRowContext(context.Background(), "SELECT RELEASE_LOCK(?)", l.name).Scan(&released); err != nil {
+		return fmt.Errorf("failed to release lock %s: %w", l.name, err)
+	}
+	if !released.Valid || released.Int64 != 1 {
+		return fmt.Errorf("%w: %s is no longer held by this connection", ErrLockLost, l.name)
+	}
+	return nil
+}
+
+// WithLock runs fn while holding the advisory lock name. It does not wait for the lock:
+// if another process holds it, fn is not run and ErrLockNotAcquired is returned, which
+// suits jobs that must not run twice at once. If fn succeeds but the lock was lost
+// while it ran, an error matching ErrLockLost is returned.
+func (r *RDSPooledConnection) WithLock(name string, fn func() error) error {
+	return r.WithLockContext(context.Background(), name, func(context.Context) error { return fn() })
+}
+
+// WithLockContext is WithLock taking the lock with ctx and passing ctx on to fn.
+func (r *RDSPooledConnection) WithLockContext(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	lock, err := r.AcquireLock(ctx, name, 0)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			_ = lock.Unlock()
+			panic(rec)
+		}
+	}()
+
+	fnErr := fn(ctx)
+	unlockErr := lock.Unlock()
+	if fnErr != nil {
+		return fnErr
+	}
+	return unlockErr
+}
@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// lockResults makes GET_LOCK return acquired and RELEASE_LOCK return 1.
+func lockResults(fdb *fakeDatabase, acquired int64) {
+	fdb.onQuery = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		if strings.Contains(query, "GET_LOCK") {
+			return []string{"GET_LOCK"}, [][]driver.Value{{acquired}}, nil
+		}
+		return []string{"RELEASE_LOCK"}, [][]driver.Value{{int64(1)}}, nil
+	}
+}
+
+func TestAcquireLockPinsConnectionUntilUnlock(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	lockResults(fdb, 1)
+
+	lock, err := rds.AcquireLock(context.Background(), "nightly-report", 1500*time.Millisecond)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, lock.Unlock())
+	assert.NoError(t, lock.Unlock())
+
+	assert.Equal(t, []string{
+		"c1 SELECT GET_LOCK(?, ?) [nightly-report 2]",
+		"c1 SELECT RELEASE_LOCK(?) [nightly-report]",
+	}, fdb.Events())
+}
+
+func TestAcquireLockHeldElsewhere(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	lockResults(fdb, 0)
+
+	_, err := rds.AcquireLock(context.Background(), "nightly-report", 0)
+
+	assert.ErrorIs(t, err, ErrLockNotAcquired)
+}
+
+func TestAdvisoryLockLostWhenConnectionDies(t *testing.T) {
+	defer func(interval time.Duration) { lockKeepaliveInterval = interval }(lockKeepaliveInterval)
+	lockKeepaliveInterval = 10 * time.Millisecond
+
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	lockResults(fdb, 1)
+	var dead atomic.Bool
+	fdb.onPing = func() error {
+		if dead.Load() {
+			return driver.ErrBadConn
+		}
+		return nil
+	}
+
+	lock, err := rds.AcquireLock(context.Background(), "nightly-report", 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+	dead.Store(true)
+
+	select {
+	case <-lock.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("lock was not reported lost")
+	}
+	assert.ErrorIs(t, lock.Err(), ErrLockLost)
+	assert.ErrorIs(t, lock.Unlock(), ErrLockLost)
+}
+
+func TestWithLock(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	lockResults(fdb, 1)
+	failure := errors.New("job failed")
+
+	err := rds.WithLock("nightly-report", func() error { return failure })
+
+	assert.ErrorIs(t, err, failure)
+	assert.Equal(t, []string{
+		"SELECT GET_LOCK(?, ?) [nightly-report 0]",
+		"SELECT RELEASE_LOCK(?) [nightly-report]",
+	}, fdb.Statements())
+
+	lockResults(fdb, 0)
+	ran := false
+	err = rds.WithLock("nightly-report", func() error { ran = true; return nil })
+	assert.ErrorIs(t, err, ErrLockNotAcquired)
+	assert.False(t, ran)
+}
+
+func TestWithLockContext(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	lockResults(fdb, 1)
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "job")
+
+	err := rds.WithLockContext(ctx, "nightly-report", func(ctx context.Context) error {
+		assert.Equal(t, "job", ctx.Value(key{}))
+		return nil
+	})
+	assert.NoError(t, err)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	ran := false
+	err = rds.WithLockContext(cancelled, "nightly-report", func(context.Context) error { ran = true; return nil })
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.False(t, ran)
+}
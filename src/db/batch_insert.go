@@ -0,0 +1,175 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultMaxAllowedPacket is the driver's and MySQL 5.7's default max_allowed_packet, 4 MiB.
+const DefaultMaxAllowedPacket = 4 << 20
+
+// maxPlaceholders is the most placeholders MySQL accepts in one prepared statement.
+const maxPlaceholders = 65535
+
+// packetOverhead is kept free in every batched statement for packet and statement
+// headers, and paramOverhead is added to each value for its type and length prefix.
+const (
+	packetOverhead = 1024
+	paramOverhead  = 11
+)
+
+// batchableInsert matches single-row INSERT ... VALUES statements whose row can be
+// repeated: no IGNORE, ON DUPLICATE KEY UPDATE or quoted text, at most one level of
+// parentheses inside the row, e.g. "INSERT INTO t (a, b) VALUES (?, NOW())".
+var batchableInsert = regexp.MustCompile(`(?is)^\s*(INSERT\s+INTO\s+[^()'"]+?(?:\([^()'"]*\))?\s*VALUES\s*)(\((?:[^()'"]|\([^()'"]*\))*\))\s*;?\s*$`)
+
+// SetInsertBatching makes ExecuteUpdates run an INSERT ... VALUES update with several
+// rows of Values as multi-row INSERTs instead of one statement per row. Each statement
+// holds as many rows as fit under maxAllowedPacket bytes, which must not exceed the
+// server's max_allowed_packet, and the 65,535 placeholder limit. Zero, the default,
+// turns batching off.
+//
+// Row counts are still reported per row. New row ids are derived as the first id of
+// each statement plus the row's position in it, which holds when InnoDB allocates the
+// statement consecutive ids: with auto_increment_increment = 1 and
+// innodb_autoinc_lock_mode 0 or 1, or mode 2 without concurrent INSERT ... SELECT
+// into the same table.
+func (r *RDSPooledConnection) SetInsertBatching(maxAllowedPacket int) {
+	r.maxAllowedPacket = maxAllowedPacket
+}
+
+// batchInsert is an INSERT ... VALUES statement split into the text before its row
+// and the row itself.
+type batchInsert struct {
+	prefix string
+	row    string
+	params int
+}
+
+// parseBatchInsert reports whether query can be run with values as multi-row INSERTs.
+func parseBatchInsert(query string, values [][]interface{}) (batchInsert, bool) {
+	match := batchableInsert.FindStringSubmatch(query)
+	if match == nil {
+		return batchInsert{}, false
+	}
+
+	batch := batchInsert{prefix: match[1], row: match[2], params: strings.Count(match[2], "?")}
+	if batch.params == 0 || batch.params > maxPlaceholders {
+		return batchInsert{}, false
+	}
+	for _, row := range values {
+		if len(row) != batch.params {
+			return batchInsert{}, false
+		}
+	}
+	return batch, true
+}
+
+// statement returns the INSERT for rows rows.
+func (b batchInsert) statement(rows int) string {
+	return b.prefix + strings.TrimSuffix(strings.Repeat(b.row+", ", rows), ", ")
+}
+
+// chunks splits values into runs of rows that each fit in one statement.
+func (b batchInsert) chunks(values [][]interface{}, maxAllowedPacket int) [][][]interface{} {
+	maxRows := maxPlaceholders / b.params
+	budget := maxAllowedPacket - packetOverhead - len(b.prefix)
+
+	var chunks [][][]interface{}
+	start, size := 0, 0
+	for i, row := range values {
+		rowSize := len(b.row) + 2
+		for _, value := range row {
+			rowSize += valueSize(value) + paramOverhead
+		}
+		if i > start && (i-start == maxRows || size+rowSize > budget) {
+			chunks = append(chunks, values[start:i])
+			start, size = i, 0
+		}
+		size += rowSize
+	}
+	return append(chunks, values[start:])
+}
+
+// valueSize estimates how many bytes value takes in a statement execution packet.
+func valueSize(value interface{}) int {
+	switch v := value.(type) {
+	case nil:
+		return 0
+	case string:
+		return len(v)
+	case []byte:
+		return len(v)
+	case bool, int8, uint8:
+		return 1
+	case int16, uint16:
+		return 2
+	case int32, uint32, float32:
+		return 4
+	case int, int64, uint, uint64, float64:
+		return 8
+	case time.Time:
+		return 12
+	}
+	return len(fmt.Sprint(value))
+}
+
+// executeBatchInsert runs batch for values in chunks, returning per-row counts and ids.
+func (r *RDSPooledConnection) executeBatchInsert(ctx context.Context, cnx preparer, batch batchInsert, values [][]interface{}) ([]int64, []int64, error) {
+	rowCounts := make([]int64, 0, len(values))
+	newRowIDs := make([]int64, 0, len(values))
+
+	for _, chunk := range batch.chunks(values, r.maxAllowedPacket) {
+		counts, ids, err := r.executeChunk(ctx, cnx, batch, chunk)
+		if err != nil {
+			return nil, nil, err
+		}
+		rowCounts = append(rowCounts, counts...)
+		newRowIDs = append(newRowIDs, ids...)
+	}
+	return rowCounts, newRowIDs, nil
+}
+
+func (r *RDSPooledConnection) executeChunk(ctx context.Context, cnx preparer, batch batchInsert, chunk [][]interface{}) (rowCounts []int64, newRowIDs []int64, err error) {
+	// Each chunk size is a different statement, possibly close to max_allowed_packet, so
+	// chunks would only crowd out the statements the cache is meant to reuse.
+	stmt, done, err := r.prepare(WithoutStatementCache(ctx), cnx, batch.statement(len(chunk)))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { done(err) }()
+
+	args := make([]interface{}, 0, len(chunk)*batch.params)
+	for _, row := range chunk {
+		args = append(args, row...)
+	}
+	res, err := stmt.ExecContext(ctx, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return nil, nil, err
+	}
+	firstID, err := res.LastInsertId()
+	if err != nil {
+		firstID = 0
+	}
+
+	// A plain multi-row INSERT either inserts every row or fails, so each row counts one.
+	rowCounts = make([]int64, len(chunk))
+	newRowIDs = make([]int64, len(chunk))
+	for i := range chunk {
+		if int64(i) < affected {
+			rowCounts[i] = 1
+		}
+		if firstID != 0 {
+			newRowIDs[i] = firstID + int64(i)
+		}
+	}
+	return rowCounts, newRowIDs, nil
+}
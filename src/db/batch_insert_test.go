@@ -0,0 +1,120 @@
+package db
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// multiRowResults makes each INSERT report one affected row per row of params placeholders,
+// with ids allocated consecutively from 100.
+func multiRowResults(fdb *fakeDatabase, params int) {
+	nextID := int64(100)
+	fdb.onExec = func(query string, args []driver.Value) (driver.Result, error) {
+		rows := int64(len(args) / params)
+		result := fakeResult{lastInsertID: nextID, rowsAffected: rows}
+		nextID += rows
+		return result, nil
+	}
+}
+
+func TestInsertBatchingRewritesIntoMultiRowInserts(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	rds.SetInsertBatching(DefaultMaxAllowedPacket)
+	multiRowResults(fdb, 2)
+
+	counts, ids, err := rds.ExecuteUpdates([]SQLUpdate{{
+		SQL:    "INSERT INTO t (a, b) VALUES (?, ?)",
+		Values: [][]interface{}{{1, "x"}, {2, "y"}, {3, "z"}},
+	}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1, 1, 1}, counts)
+	assert.Equal(t, []int64{100, 101, 102}, ids)
+	assert.Equal(t, []string{"INSERT INTO t (a, b) VALUES (?, ?), (?, ?), (?, ?) [1 x 2 y 3 z]"}, fdb.Statements())
+}
+
+func TestInsertBatchingChunksByPlaceholders(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	rds.SetInsertBatching(1 << 30)
+	multiRowResults(fdb, 3)
+
+	values := make([][]interface{}, 30000)
+	for i := range values {
+		values[i] = []interface{}{i, i, i}
+	}
+	counts, ids, err := rds.ExecuteUpdates([]SQLUpdate{{SQL: "INSERT INTO t VALUES (?, ?, NOW(), ?)", Values: values}})
+
+	assert.NoError(t, err)
+	assert.Len(t, counts, 30000)
+	assert.Equal(t, int64(100+29999), ids[29999])
+	statements := fdb.Statements()
+	if assert.Len(t, statements, 2) {
+		assert.Equal(t, 21845, strings.Count(statements[0], "NOW()"))
+		assert.Equal(t, 30000-21845, strings.Count(statements[1], "NOW()"))
+	}
+}
+
+func TestInsertBatchingChunksByPacketSize(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	rds.SetInsertBatching(packetOverhead + len("INSERT INTO t VALUES ") + 100)
+	multiRowResults(fdb, 1)
+
+	blob := strings.Repeat("x", 30)
+	_, ids, err := rds.ExecuteUpdates([]SQLUpdate{{
+		SQL:    "INSERT INTO t VALUES (?)",
+		Values: [][]interface{}{{blob}, {blob}, {blob}},
+	}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{100, 101, 102}, ids)
+	assert.Equal(t, []string{
+		"INSERT INTO t VALUES (?), (?) [" + blob + " " + blob + "]",
+		"INSERT INTO t VALUES (?) [" + blob + "]",
+	}, fdb.Statements())
+}
+
+func TestInsertBatchingLeavesOtherStatementsAlone(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	rds.SetInsertBatching(DefaultMaxAllowedPacket)
+
+	for _, query := range []string{
+		"UPDATE t SET a = ? WHERE id = ?",
+		"INSERT IGNORE INTO t VALUES (?, ?)",
+		"INSERT INTO t VALUES (?, ?) ON DUPLICATE KEY UPDATE a = VALUES(a)",
+		"INSERT INTO t VALUES (?, 'a)')",
+	} {
+		fdb.events = nil
+		_, _, err := rds.ExecuteUpdates([]SQLUpdate{{SQL: query, Values: [][]interface{}{{1, 2}, {3, 4}}}})
+		assert.NoError(t, err)
+		assert.Len(t, fdb.Statements(), 2, query)
+	}
+}
+
+func TestInsertBatchingBypassesStatementCache(t *testing.T) {
+	rds, fdb := newCachedRDS(t, 10)
+	rds.SetInsertBatching(DefaultMaxAllowedPacket)
+	multiRowResults(fdb, 1)
+
+	err := rds.ExecuteFunctions([]func() error{func() error {
+		for rows := 2; rows <= 5; rows++ {
+			values := make([][]interface{}, rows)
+			for i := range values {
+				values[i] = []interface{}{i}
+			}
+			if _, _, err := rds.ExecuteUpdates([]SQLUpdate{{SQL: "INSERT INTO t VALUES (?)", Values: values}}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, StatementCacheStats{}, rds.StatementCacheStats())
+}
@@ -3,9 +3,11 @@ package db
 import (
 	"database/sql"
 	"fmt"
-	"log"
+	"net"
+	"strconv"
+	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 )
 
 var (
@@ -14,15 +16,130 @@ var (
 	RdsConnPool   *RDSPooledConnection
 )
 
-func init() {
-	var err error
-	mysqlConnPool, err = sql.Open("mysql", "root:root@tcp(localhost:3306)/")
+// Config holds everything needed to build a connection pool: the DSN parts,
+// the pool limits and the driver timeouts. Zero values leave the
+// database/sql and driver defaults in place.
+type Config struct {
+	User     string
+	Password string
+	Host     string
+	Port     int
+	Database string
+	Params   map[string]string // Extra DSN parameters, e.g. "charset".
+
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	// TransactionTimeout bounds how long a transaction registered in the
+	// TransactionManagerRegistry may stay open; zero means no limit.
+	TransactionTimeout time.Duration
+
+	// StatementCacheSize is how many prepared statements RDSPooledConnection keeps
+	// for reuse; zero disables the cache.
+	StatementCacheSize int
+}
+
+// DefaultConfig returns the configuration used for the package-level default pool.
+func DefaultConfig() Config {
+	return Config{
+		User:     "root",
+		Password: "root",
+		Host:     "localhost",
+		Port:     3306,
+	}
+}
+
+// DSN formats the configuration as a go-sql-driver/mysql data source name.
+func (c Config) DSN() string {
+	mysqlConfig := mysql.NewConfig()
+	mysqlConfig.User = c.User
+	mysqlConfig.Passwd = c.Password
+	mysqlConfig.Net = "tcp"
+	mysqlConfig.Addr = net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+	mysqlConfig.DBName = c.Database
+	mysqlConfig.Params = c.Params
+	mysqlConfig.Timeout = c.DialTimeout
+	mysqlConfig.ReadTimeout = c.ReadTimeout
+	mysqlConfig.WriteTimeout = c.WriteTimeout
+	return mysqlConfig.FormatDSN()
+}
+
+// DB bundles a connection pool with the TransactionManagerRegistry and
+// RDSPooledConnection built on top of it.
+type DB struct {
+	Pool       *sql.DB
+	TxManagers *TransactionManagerRegistry
+	Conn       *RDSPooledConnection
+}
+
+// Open builds a connection pool, transaction manager registry and pooled connection from cfg.
+// No connection is made until the first statement runs.
+func Open(cfg Config) (*DB, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	pool, err := sql.Open("mysql", cfg.DSN())
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("failed to open connection pool: %w", err)
 	}
 
-	TxManagerPool = NewTransactionManagerRegistry(mysqlConnPool)
-	RdsConnPool = NewRDSPooledConnection(mysqlConnPool, TxManagerPool)
+	pool.SetMaxOpenConns(cfg.MaxOpenConns)
+	if cfg.MaxIdleConns != 0 {
+		pool.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	pool.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	pool.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
 
-	fmt.Println("RDS Connection Pool and Transaction Manager initialized.")
+	txManagers := NewTransactionManagerRegistry(pool)
+	txManagers.SetTransactionTimeout(cfg.TransactionTimeout)
+	conn := NewRDSPooledConnection(pool, txManagers)
+	conn.SetStatementCacheSize(cfg.StatementCacheSize)
+	return &DB{
+		Pool:       pool,
+		TxManagers: txManagers,
+		Conn:       conn,
+	}, nil
+}
+
+// Close closes the underlying connection pool.
+func (d *DB) Close() error {
+	return d.Pool.Close()
+}
+
+// SetDefault replaces the package-level RdsConnPool and TxManagerPool with the ones from d.
+func SetDefault(d *DB) {
+	mysqlConnPool = d.Pool
+	TxManagerPool = d.TxManagers
+	RdsConnPool = d.Conn
+}
+
+// init sets up the package-level default pool from DefaultConfig. It reads neither
+// files nor the environment, and sql.Open does not dial, so importing the package has
+// no side effects beyond allocating the pool. To configure the default pool from
+// GENERICDB_CONFIG and GENERICDB_* variables, opt in explicitly:
+//
+//	cfg, err := db.LoadConfig("")
+//	if err != nil {
+//		return err
+//	}
+//	d, err := db.Open(cfg)
+//	if err != nil {
+//		return err
+//	}
+//	db.SetDefault(d)
+func init() {
+	d, err := Open(DefaultConfig())
+	if err != nil {
+		// DefaultConfig is always valid, so this is a programming error; failing here
+		// beats a nil pointer dereference on first use.
+		panic(fmt.Sprintf("failed to initialize default connection pool: %v", err))
+	}
+	SetDefault(d)
 }
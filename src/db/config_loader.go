@@ -0,0 +1,272 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is the prefix of every environment variable read by LoadConfig.
+const EnvPrefix = "GENERICDB_"
+
+// ConfigFileEnv names the environment variable holding the config file path
+// used when LoadConfig is called with an empty path.
+const ConfigFileEnv = EnvPrefix + "CONFIG"
+
+// ConfigError reports a configuration value that could not be parsed or is invalid.
+// Field is the Config field, file key or environment variable that was at fault.
+type ConfigError struct {
+	Field string
+	Err   error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("invalid config field %s: %v", e.Field, e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// fileConfig is the on-disk shape of a Config. Durations are strings such as
+// "30s" so YAML and JSON files are read the same way.
+type fileConfig struct {
+	User     *string           `yaml:"user" json:"user"`
+	Password *string           `yaml:"password" json:"password"`
+	Host     *string           `yaml:"host" json:"host"`
+	Port     *int              `yaml:"port" json:"port"`
+	Database *string           `yaml:"database" json:"database"`
+	Params   map[string]string `yaml:"params" json:"params"`
+
+	MaxOpenConns    *int    `yaml:"maxOpenConns" json:"maxOpenConns"`
+	MaxIdleConns    *int    `yaml:"maxIdleConns" json:"maxIdleConns"`
+	ConnMaxLifetime *string `yaml:"connMaxLifetime" json:"connMaxLifetime"`
+	ConnMaxIdleTime *string `yaml:"connMaxIdleTime" json:"connMaxIdleTime"`
+
+	DialTimeout  *string `yaml:"dialTimeout" json:"dialTimeout"`
+	ReadTimeout  *string `yaml:"readTimeout" json:"readTimeout"`
+	WriteTimeout *string `yaml:"writeTimeout" json:"writeTimeout"`
+
+	TransactionTimeout *string `yaml:"transactionTimeout" json:"transactionTimeout"`
+
+	StatementCacheSize *int `yaml:"statementCacheSize" json:"statementCacheSize"`
+}
+
+// LoadConfig builds a Config in three layers, each overriding the one before:
+// DefaultConfig, the YAML or JSON file at path, and GENERICDB_* environment variables.
+// If path is empty the file named by GENERICDB_CONFIG is used, and if that is unset
+// too only the environment is applied. The result is validated before it is returned.
+func LoadConfig(path string) (Config, error) {
+	cfg := DefaultConfig()
+
+	if path == "" {
+		path = os.Getenv(ConfigFileEnv)
+	}
+	if path != "" {
+		if err := cfg.ApplyFile(path); err != nil {
+			return Config{}, err
+		}
+	}
+
+	if err := cfg.ApplyEnv(os.LookupEnv); err != nil {
+		return Config{}, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// ApplyFile overrides c with the values set in the file at path. Files ending in
+// .json are decoded as JSON, everything else as YAML.
+func (c *Config) ApplyFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var fc fileConfig
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&fc)
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&fc)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return c.applyFileConfig(fc)
+}
+
+func (c *Config) applyFileConfig(fc fileConfig) error {
+	setString(&c.User, fc.User)
+	setString(&c.Password, fc.Password)
+	setString(&c.Host, fc.Host)
+	setInt(&c.Port, fc.Port)
+	setString(&c.Database, fc.Database)
+	if fc.Params != nil {
+		c.Params = fc.Params
+	}
+	setInt(&c.MaxOpenConns, fc.MaxOpenConns)
+	setInt(&c.MaxIdleConns, fc.MaxIdleConns)
+	setInt(&c.StatementCacheSize, fc.StatementCacheSize)
+
+	durations := []struct {
+		field string
+		value *string
+		dst   *time.Duration
+	}{
+		{"connMaxLifetime", fc.ConnMaxLifetime, &c.ConnMaxLifetime},
+		{"connMaxIdleTime", fc.ConnMaxIdleTime, &c.ConnMaxIdleTime},
+		{"dialTimeout", fc.DialTimeout, &c.DialTimeout},
+		{"readTimeout", fc.ReadTimeout, &c.ReadTimeout},
+		{"writeTimeout", fc.WriteTimeout, &c.WriteTimeout},
+		{"transactionTimeout", fc.TransactionTimeout, &c.TransactionTimeout},
+	}
+	for _, d := range durations {
+		if d.value == nil {
+			continue
+		}
+		parsed, err := time.ParseDuration(*d.value)
+		if err != nil {
+			return &ConfigError{Field: d.field, Err: err}
+		}
+		*d.dst = parsed
+	}
+	return nil
+}
+
+// ApplyEnv overrides c with the GENERICDB_* variables that lookup reports as set.
+// GENERICDB_PARAMS is a query string such as "charset=utf8mb4&parseTime=true".
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	stringVars := []struct {
+		name string
+		dst  *string
+	}{
+		{"USER", &c.User},
+		{"PASSWORD", &c.Password},
+		{"HOST", &c.Host},
+		{"DATABASE", &c.Database},
+	}
+	for _, v := range stringVars {
+		if value, ok := lookup(EnvPrefix + v.name); ok {
+			*v.dst = value
+		}
+	}
+
+	intVars := []struct {
+		name string
+		dst  *int
+	}{
+		{"PORT", &c.Port},
+		{"MAX_OPEN_CONNS", &c.MaxOpenConns},
+		{"MAX_IDLE_CONNS", &c.MaxIdleConns},
+		{"STATEMENT_CACHE_SIZE", &c.StatementCacheSize},
+	}
+	for _, v := range intVars {
+		if value, ok := lookup(EnvPrefix + v.name); ok {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				return &ConfigError{Field: EnvPrefix + v.name, Err: err}
+			}
+			*v.dst = parsed
+		}
+	}
+
+	durationVars := []struct {
+		name string
+		dst  *time.Duration
+	}{
+		{"CONN_MAX_LIFETIME", &c.ConnMaxLifetime},
+		{"CONN_MAX_IDLE_TIME", &c.ConnMaxIdleTime},
+		{"DIAL_TIMEOUT", &c.DialTimeout},
+		{"READ_TIMEOUT", &c.ReadTimeout},
+		{"WRITE_TIMEOUT", &c.WriteTimeout},
+		{"TRANSACTION_TIMEOUT", &c.TransactionTimeout},
+	}
+	for _, v := range durationVars {
+		if value, ok := lookup(EnvPrefix + v.name); ok {
+			parsed, err := time.ParseDuration(value)
+			if err != nil {
+				return &ConfigError{Field: EnvPrefix + v.name, Err: err}
+			}
+			*v.dst = parsed
+		}
+	}
+
+	if value, ok := lookup(EnvPrefix + "PARAMS"); ok {
+		query, err := url.ParseQuery(value)
+		if err != nil {
+			return &ConfigError{Field: EnvPrefix + "PARAMS", Err: err}
+		}
+		c.Params = make(map[string]string, len(query))
+		for key := range query {
+			c.Params[key] = query.Get(key)
+		}
+	}
+	return nil
+}
+
+// Validate checks that c describes a usable connection pool. The returned
+// *ConfigError names the first offending field.
+func (c Config) Validate() error {
+	switch {
+	case c.Host == "":
+		return &ConfigError{Field: "Host", Err: errors.New("must not be empty")}
+	case c.Port < 1 || c.Port > 65535:
+		return &ConfigError{Field: "Port", Err: fmt.Errorf("%d is out of range 1-65535", c.Port)}
+	case c.User == "" && c.Password != "":
+		return &ConfigError{Field: "User", Err: errors.New("must be set when Password is set")}
+	case c.MaxOpenConns < 0:
+		return &ConfigError{Field: "MaxOpenConns", Err: errors.New("must not be negative")}
+	case c.MaxIdleConns < 0:
+		return &ConfigError{Field: "MaxIdleConns", Err: errors.New("must not be negative")}
+	case c.MaxOpenConns > 0 && c.MaxIdleConns > c.MaxOpenConns:
+		return &ConfigError{Field: "MaxIdleConns", Err: fmt.Errorf("%d exceeds MaxOpenConns %d", c.MaxIdleConns, c.MaxOpenConns)}
+	case c.StatementCacheSize < 0:
+		return &ConfigError{Field: "StatementCacheSize", Err: errors.New("must not be negative")}
+	}
+
+	durations := []struct {
+		field string
+		value time.Duration
+	}{
+		{"ConnMaxLifetime", c.ConnMaxLifetime},
+		{"ConnMaxIdleTime", c.ConnMaxIdleTime},
+		{"DialTimeout", c.DialTimeout},
+		{"ReadTimeout", c.ReadTimeout},
+		{"WriteTimeout", c.WriteTimeout},
+		{"TransactionTimeout", c.TransactionTimeout},
+	}
+	for _, d := range durations {
+		if d.value < 0 {
+			return &ConfigError{Field: d.field, Err: errors.New("must not be negative")}
+		}
+	}
+	return nil
+}
+
+func setString(dst *string, value *string) {
+	if value != nil {
+		*dst = *value
+	}
+}
+
+func setInt(dst *int, value *int) {
+	if value != nil {
+		*dst = *value
+	}
+}
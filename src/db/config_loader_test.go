@@ -0,0 +1,108 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func envLookup(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+}
+
+func TestConfigApplyEnv(t *testing.T) {
+	cfg := DefaultConfig()
+	err := cfg.ApplyEnv(envLookup(map[string]string{
+		"GENERICDB_HOST":                 "db.internal",
+		"GENERICDB_PORT":                 "3307",
+		"GENERICDB_MAX_OPEN_CONNS":       "20",
+		"GENERICDB_READ_TIMEOUT":         "3s",
+		"GENERICDB_PARAMS":               "charset=utf8mb4&parseTime=true",
+		"GENERICDB_STATEMENT_CACHE_SIZE": "64",
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, "db.internal", cfg.Host)
+	assert.Equal(t, 3307, cfg.Port)
+	assert.Equal(t, 20, cfg.MaxOpenConns)
+	assert.Equal(t, 3*time.Second, cfg.ReadTimeout)
+	assert.Equal(t, map[string]string{"charset": "utf8mb4", "parseTime": "true"}, cfg.Params)
+	assert.Equal(t, 64, cfg.StatementCacheSize)
+	assert.Equal(t, "root", cfg.User)
+}
+
+func TestConfigApplyEnvNamesBadVariable(t *testing.T) {
+	cfg := DefaultConfig()
+	err := cfg.ApplyEnv(envLookup(map[string]string{"GENERICDB_PORT": "mysql"}))
+
+	var configErr *ConfigError
+	assert.True(t, errors.As(err, &configErr))
+	assert.Equal(t, "GENERICDB_PORT", configErr.Field)
+}
+
+func TestConfigApplyFile(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "db.yaml")
+	jsonPath := filepath.Join(dir, "db.json")
+	assert.NoError(t, os.WriteFile(yamlPath, []byte("host: yaml-host\nport: 3310\nconnMaxLifetime: 5m\n"), 0o600))
+	assert.NoError(t, os.WriteFile(jsonPath, []byte(`{"host": "json-host", "maxIdleConns": 4}`), 0o600))
+
+	yamlConfig := DefaultConfig()
+	assert.NoError(t, yamlConfig.ApplyFile(yamlPath))
+	assert.Equal(t, "yaml-host", yamlConfig.Host)
+	assert.Equal(t, 3310, yamlConfig.Port)
+	assert.Equal(t, 5*time.Minute, yamlConfig.ConnMaxLifetime)
+
+	jsonConfig := DefaultConfig()
+	assert.NoError(t, jsonConfig.ApplyFile(jsonPath))
+	assert.Equal(t, "json-host", jsonConfig.Host)
+	assert.Equal(t, 3306, jsonConfig.Port)
+	assert.Equal(t, 4, jsonConfig.MaxIdleConns)
+}
+
+func TestConfigApplyFileNamesBadKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("dialTimeout: soon\n"), 0o600))
+
+	cfg := DefaultConfig()
+	err := cfg.ApplyFile(path)
+
+	var configErr *ConfigError
+	assert.True(t, errors.As(err, &configErr))
+	assert.Equal(t, "dialTimeout", configErr.Field)
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("host: file-host\ndatabase: orders\n"), 0o600))
+	t.Setenv("GENERICDB_HOST", "env-host")
+
+	cfg, err := LoadConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "env-host", cfg.Host)
+	assert.Equal(t, "orders", cfg.Database)
+	assert.Equal(t, 3306, cfg.Port)
+}
+
+func TestConfigValidate(t *testing.T) {
+	cfg := DefaultConfig()
+	assert.NoError(t, cfg.Validate())
+
+	cfg.MaxOpenConns = 5
+	cfg.MaxIdleConns = 10
+	err := cfg.Validate()
+
+	var configErr *ConfigError
+	assert.True(t, errors.As(err, &configErr))
+	assert.Equal(t, "MaxIdleConns", configErr.Field)
+
+	_, err = Open(Config{Host: "localhost"})
+	assert.True(t, errors.As(err, &configErr))
+	assert.Equal(t, "Port", configErr.Field)
+}
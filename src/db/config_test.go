@@ -0,0 +1,44 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultConfigDSN(t *testing.T) {
+	assert.Equal(t, "root:root@tcp(localhost:3306)/", DefaultConfig().DSN())
+}
+
+func TestConfigDSN(t *testing.T) {
+	cfg := Config{
+		User:        "app",
+		Password:    "secret",
+		Host:        "db.internal",
+		Port:        3307,
+		Database:    "orders",
+		Params:      map[string]string{"charset": "utf8mb4"},
+		DialTimeout: 5 * time.Second,
+	}
+	assert.Equal(t, "app:secret@tcp(db.internal:3307)/orders?timeout=5s&charset=utf8mb4", cfg.DSN())
+}
+
+func TestOpen(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxOpenConns = 7
+	d, err := Open(cfg)
+	assert.NoError(t, err)
+	defer d.Close()
+
+	assert.Equal(t, 7, d.Pool.Stats().MaxOpenConnections)
+	assert.Same(t, d.TxManagers, d.Conn.txManagerPool)
+	assert.NotSame(t, TxManagerPool, d.TxManagers)
+}
+
+func TestDefaultPoolIsInitialized(t *testing.T) {
+	if assert.NotNil(t, RdsConnPool) && assert.NotNil(t, TxManagerPool) {
+		assert.Same(t, TxManagerPool, RdsConnPool.txManagerPool)
+		assert.Zero(t, TxManagerPool.timeout)
+	}
+}
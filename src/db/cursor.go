@@ -0,0 +1,141 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/anmollp/generic-db-go/src/dberrors"
+	"github.com/anmollp/generic-db-go/src/utils"
+)
+
+// ErrCursorOpen is returned for a statement run in a transaction by the goroutine that
+// has a Cursor open in it, since the statement would wait for the cursor forever.
+var ErrCursorOpen = errors.New("a cursor is still open in the transaction")
+
+// Cursor streams the rows of a query one at a time instead of buffering them all like
+// ExecuteQuery does. Iterate it with Next, read each row with Scan or Map and check Err
+// once Next returns false:
+//
+//	cursor, err := rds.QueryCursor(ctx, "SELECT id, name FROM users", nil)
+//	if err != nil {
+//		return err
+//	}
+//	defer cursor.Close()
+//	for cursor.Next() {
+//		var id int64
+//		var name string
+//		if err := cursor.Scan(&id, &name); err != nil {
+//			return err
+//		}
+//	}
+//	return cursor.Err()
+type Cursor struct {
+	ctx      context.Context
+	sql      string
+	rows     *sql.Rows
+	stmtDone func(err error)
+	release  func()
+	mapper   *rowMapper
+	err      error
+	closed   bool
+}
+
+// QueryCursor runs a query and returns a Cursor over its rows. Like ExecuteQueryContext
+// it runs in the transaction carried by ctx or registered for the current goroutine, if
+// any. The connection is held until the cursor is closed, which happens once Next has
+// returned every row or ctx is done. Inside a transaction no other statement of the
+// transaction can run until then, so finish or Close the cursor first: statements from
+// the goroutine that opened it fail with ErrCursorOpen, and those from goroutines
+// started with Go wait for it.
+func (r *RDSPooledConnection) QueryCursor(ctx context.Context, sqlQuery string, params []interface{}) (*Cursor, error) {
+	txManager, inTransaction := r.transactionManagerFor(ctx)
+	ctx, cnx, release, err := r.acquire(ctx, true)
+	if err != nil {
+		return nil, dberrors.Classify(err, sqlQuery, 0)
+	}
+	if inTransaction {
+		txManager.openCursor(utils.GetGoroutineID())
+		unlock := release
+		release = func() {
+			txManager.openCursor(0)
+			unlock()
+		}
+	}
+
+	stmt, done, err := r.prepare(ctx, cnx, sqlQuery)
+	if err != nil {
+		release()
+		return nil, dberrors.Classify(err, sqlQuery, 0)
+	}
+
+	rows, err := stmt.QueryContext(ctx, params...)
+	if err != nil {
+		done(err)
+		release()
+		return nil, dberrors.Classify(err, sqlQuery, 0)
+	}
+
+	mapper, err := newRowMapper(rows, r.typeMapping)
+	if err != nil {
+		rows.Close()
+		done(err)
+		release()
+		return nil, err
+	}
+
+	return &Cursor{ctx: ctx, sql: sqlQuery, rows: rows, stmtDone: done, release: release, mapper: mapper}, nil
+}
+
+// Next advances to the next row, returning false and closing the cursor once there are
+// no more rows, an error occurred or the cursor's context is done.
+func (c *Cursor) Next() bool {
+	if c.closed {
+		return false
+	}
+	if err := c.ctx.Err(); err != nil {
+		c.err = err
+		c.Close()
+		return false
+	}
+	if !c.rows.Next() {
+		c.err = dberrors.Classify(c.rows.Err(), c.sql, 0)
+		c.Close()
+		return false
+	}
+	return true
+}
+
+// Columns returns the column names of the query.
+func (c *Cursor) Columns() []string {
+	return c.mapper.columns
+}
+
+// Scan copies the columns of the current row into dest, like sql.Rows.Scan.
+func (c *Cursor) Scan(dest ...interface{}) error {
+	return c.rows.Scan(dest...)
+}
+
+// Map returns the current row as a map from column name to value, converted like the
+// rows ExecuteQuery returns.
+func (c *Cursor) Map() (map[string]interface{}, error) {
+	return c.mapper.scan(c.rows)
+}
+
+// Err returns the error that ended the iteration, if any.
+func (c *Cursor) Err() error {
+	return c.err
+}
+
+// Close releases the cursor's connection. It is safe to call more than once.
+func (c *Cursor) Close() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+
+	err := c.rows.Close()
+	c.stmtDone(c.err)
+	c.release()
+	return err
+}
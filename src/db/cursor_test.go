@@ -0,0 +1,169 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// numberRows makes the fake database return n rows with a single number column.
+func numberRows(fdb *fakeDatabase, n int) {
+	fdb.onQuery = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		var rows [][]driver.Value
+		for i := 1; i <= n; i++ {
+			rows = append(rows, []driver.Value{int64(i)})
+		}
+		return []string{"number"}, rows, nil
+	}
+}
+
+func TestCursorStreamsRowsAndReleasesConnection(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	numberRows(fdb, 3)
+
+	cursor, err := rds.QueryCursor(context.Background(), "SELECT number FROM numbers", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"number"}, cursor.Columns())
+	assert.Equal(t, 1, pool.Stats().InUse)
+
+	var numbers []int64
+	for cursor.Next() {
+		var number int64
+		assert.NoError(t, cursor.Scan(&number))
+		numbers = append(numbers, number)
+	}
+
+	assert.NoError(t, cursor.Err())
+	assert.Equal(t, []int64{1, 2, 3}, numbers)
+	assert.Equal(t, 0, pool.Stats().InUse, "connection should be released once the rows are exhausted")
+	assert.NoError(t, cursor.Close())
+}
+
+func TestCursorMap(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	numberRows(fdb, 1)
+
+	cursor, err := rds.QueryCursor(context.Background(), "SELECT number FROM numbers", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer cursor.Close()
+
+	assert.True(t, cursor.Next())
+	row, err := cursor.Map()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"number": int64(1)}, row)
+}
+
+func TestCursorStopsWhenContextIsCancelled(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	numberRows(fdb, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cursor, err := rds.QueryCursor(ctx, "SELECT number FROM numbers", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.True(t, cursor.Next())
+	cancel()
+
+	assert.False(t, cursor.Next())
+	assert.ErrorIs(t, cursor.Err(), context.Canceled)
+	assert.Equal(t, 0, pool.Stats().InUse)
+}
+
+func TestCursorInsideTransactionHoldsStatements(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	tmr := NewTransactionManagerRegistry(pool)
+	rds := NewRDSPooledConnection(pool, tmr)
+	numberRows(fdb, 2)
+
+	err := rds.ExecuteFunctions([]func() error{func() error {
+		cursor, err := rds.QueryCursor(context.Background(), "SELECT number FROM numbers FOR UPDATE", nil)
+		if err != nil {
+			return err
+		}
+		for cursor.Next() {
+		}
+		if err := cursor.Err(); err != nil {
+			return err
+		}
+		return execUpdate(rds, "UPDATE numbers SET number = number + 1")()
+	}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"BEGIN",
+		"SELECT number FROM numbers FOR UPDATE []",
+		"UPDATE numbers SET number = number + 1 []",
+		"COMMIT",
+	}, fdb.Statements())
+}
+
+func TestStatementWhileOwnCursorIsOpenFailsFast(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	numberRows(fdb, 2)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- rds.ExecuteFunctions([]func() error{func() error {
+			cursor, err := rds.QueryCursor(context.Background(), "SELECT number FROM numbers", nil)
+			if err != nil {
+				return err
+			}
+			defer cursor.Close()
+			for cursor.Next() {
+				if err := execUpdate(rds, "UPDATE numbers SET number = number + 1")(); err != nil {
+					return err
+				}
+			}
+			return cursor.Err()
+		}})
+	}()
+
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, ErrCursorOpen)
+	case <-time.After(time.Second):
+		t.Fatal("statement blocked on the open cursor")
+	}
+	assert.Equal(t, []string{"BEGIN", "SELECT number FROM numbers []", "ROLLBACK"}, fdb.Statements())
+}
+
+func TestGoChildWaitsForCursor(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	tmr := NewTransactionManagerRegistry(pool)
+	rds := NewRDSPooledConnection(pool, tmr)
+	numberRows(fdb, 2)
+
+	err := rds.ExecuteFunctions([]func() error{func() error {
+		cursor, err := rds.QueryCursor(context.Background(), "SELECT number FROM numbers", nil)
+		if err != nil {
+			return err
+		}
+		tmr.Go(execUpdate(rds, "UPDATE numbers SET number = 0"))
+		time.Sleep(10 * time.Millisecond)
+		for cursor.Next() {
+		}
+		return cursor.Err()
+	}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"BEGIN",
+		"SELECT number FROM numbers []",
+		"UPDATE numbers SET number = 0 []",
+		"COMMIT",
+	}, fdb.Statements())
+}
@@ -3,8 +3,9 @@ package db
 import (
 	"context"
 	"database/sql"
-	"log"
 	"sync"
+
+	"github.com/anmollp/generic-db-go/src/dberrors"
 )
 
 type SQLUpdate struct {
@@ -13,168 +14,307 @@ type SQLUpdate struct {
 }
 
 type RDSPooledConnection struct {
-	cnxPool       *sql.DB
-	txManagerPool *TransactionManagerRegistry
-	mu            sync.Mutex
+	cnxPool          *sql.DB
+	txManagerPool    *TransactionManagerRegistry
+	typeMapping      TypeMapping
+	stmtCache        *stmtCache
+	maxAllowedPacket int
+	mu               sync.Mutex
 }
 
 func NewRDSPooledConnection(cnxPool *sql.DB, txManagerPool *TransactionManagerRegistry) *RDSPooledConnection {
 	return &RDSPooledConnection{
 		cnxPool:       cnxPool,
 		txManagerPool: txManagerPool,
+		typeMapping:   DefaultTypeMapping(),
+	}
+}
+
+// preparer is implemented by *sql.DB, *sql.Conn and *sql.Tx, so statements can run
+// on the pool, on a pooled connection or inside the active transaction.
+type preparer interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// acquire returns what the next statements should run on: this connection's branch of
+// the XA transaction carried by ctx, else the transaction carried by ctx, else the
+// transaction of the TransactionManager registered for the current goroutine, else the
+// pool itself if single is set and the statement cache is in use, else a fresh pooled
+// connection. single must only be set for a lone statement run once: on the pool each
+// execution may get a different connection, losing session state such as user
+// variables, temporary tables and LAST_INSERT_ID() between statements. release must be
+// called once the statements are done, which must run with the returned context:
+// inside a transaction it is also done when the transaction's context is. A transaction
+// in which the calling goroutine has a Cursor open fails with ErrCursorOpen.
+func (r *RDSPooledConnection) acquire(ctx context.Context, single bool) (stmtCtx context.Context, cnx preparer, release func(), err error) {
+	if branch, ok := xaBranchFromContext(ctx, r); ok {
+		branch.mu.Lock()
+		return ctx, branch.conn, branch.mu.Unlock, nil
+	}
+
+	if txManager, ok := r.activeTransactionManager(ctx); ok {
+		if txManager.cursorOpenHere() {
+			return nil, nil, nil, ErrCursorOpen
+		}
+		txManager.stmtMu.Lock()
+		tx, err := txManager.GetTransaction()
+		if err != nil {
+			txManager.stmtMu.Unlock()
+			return nil, nil, nil, err
+		}
+		stmtCtx, cancel := txManager.statementContext(ctx)
+		return stmtCtx, tx, func() {
+			cancel()
+			txManager.stmtMu.Unlock()
+		}, nil
 	}
+
+	if single && r.useStmtCache(ctx) {
+		return ctx, r.cnxPool, func() {}, nil
+	}
+
+	conn, err := r.cnxPool.Conn(ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return ctx, conn, func() { conn.Close() }, nil
 }
 
+// transactionManagerFor returns the TransactionManager whose transaction acquire runs
+// statements with ctx in, if any.
+func (r *RDSPooledConnection) transactionManagerFor(ctx context.Context) (*TransactionManager, bool) {
+	if _, ok := xaBranchFromContext(ctx, r); ok {
+		return nil, false
+	}
+	return r.activeTransactionManager(ctx)
+}
+
+// ExecuteQuery runs a query and returns its rows as []map[string]interface{}, or only
+// the first row as map[string]interface{} if fetchOne is set. Values are converted by
+// column type as set with SetTypeMapping. Inside a registered transaction the query
+// runs in that transaction and sees its uncommitted writes; use ExecuteQueryContext
+// with WithoutTransaction to read outside of it. Database errors are returned as
+// *dberrors.Error when dberrors can classify them.
 func (r *RDSPooledConnection) ExecuteQuery(sqlQuery string, params []interface{}, fetchOne bool) (interface{}, error) {
-	var cnx *sql.Conn
-	var rows *sql.Rows
-	var err error
+	return r.ExecuteQueryContext(context.Background(), sqlQuery, params, fetchOne)
+}
+
+// ExecuteQueryContext is ExecuteQuery running in the transaction carried by ctx, if any.
+func (r *RDSPooledConnection) ExecuteQueryContext(ctx context.Context, sqlQuery string, params []interface{}, fetchOne bool) (interface{}, error) {
+	var results []map[string]interface{}
 
-	cnx, err = r.cnxPool.Conn(context.Background())
+	err := r.queryRows(ctx, sqlQuery, params, func(rows *sql.Rows) error {
+		var err error
+		results, err = scanRowMaps(rows, r.typeMapping)
+		return err
+	})
 	if err != nil {
-		log.Printf("Error getting connection: %v", err)
 		return nil, err
 	}
-	defer cnx.Close()
 
-	stmt, err := cnx.PrepareContext(context.Background(), sqlQuery)
+	if fetchOne && len(results) > 0 {
+		return results[0], nil
+	}
+
+	return results, nil
+}
+
+// queryRows runs a query on what acquire returns for ctx and hands the rows to scan,
+// closing them afterwards. Database errors are classified with dberrors.
+func (r *RDSPooledConnection) queryRows(ctx context.Context, sqlQuery string, params []interface{}, scan func(rows *sql.Rows) error) (err error) {
+	defer func() { err = dberrors.Classify(err, sqlQuery, 0) }()
+
+	ctx, cnx, release, err := r.acquire(ctx, true)
 	if err != nil {
-		log.Printf("Error preparing query: %v", err)
-		return nil, err
+		return err
 	}
-	defer stmt.Close()
+	defer release()
 
-	rows, err = stmt.QueryContext(context.Background(), params...)
+	stmt, done, err := r.prepare(ctx, cnx, sqlQuery)
 	if err != nil {
-		log.Printf("Error executing query: %v", err)
-		return nil, err
+		return err
+	}
+	defer func() { done(err) }()
+
+	rows, err := stmt.QueryContext(ctx, params...)
+	if err != nil {
+		return err
 	}
 	defer rows.Close()
 
+	if err := scan(rows); err != nil {
+		return err
+	}
+	return rows.Err()
+}
+
+// scanRowMaps reads every row into a map from column name to value, converting values
+// with mapping.
+func scanRowMaps(rows *sql.Rows, mapping TypeMapping) ([]map[string]interface{}, error) {
 	var results []map[string]interface{}
 
-	columns, err := rows.Columns()
+	mapper, err := newRowMapper(rows, mapping)
 	if err != nil {
 		return nil, err
 	}
 
 	for rows.Next() {
-		rowData := make([]interface{}, len(columns))
-		rowPointers := make([]interface{}, len(columns))
-		for i := range rowData {
-			rowPointers[i] = &rowData[i]
-		}
-
-		if err := rows.Scan(rowPointers...); err != nil {
+		rowMap, err := mapper.scan(rows)
+		if err != nil {
 			return nil, err
 		}
-
-		rowMap := make(map[string]interface{})
-		for i, colName := range columns {
-			rowMap[colName] = rowData[i]
-		}
 		results = append(results, rowMap)
 	}
-
-	if fetchOne && len(results) > 0 {
-		return results[0], nil
-	}
-
 	return results, nil
 }
 
+// ExecuteUpdates runs each update, once per row of Values or once if Values is nil.
+// Inside a registered transaction the updates run in that transaction; otherwise
+// each statement is autocommitted. Database errors are returned as *dberrors.Error,
+// carrying the index of the failed update, when dberrors can classify them.
 func (r *RDSPooledConnection) ExecuteUpdates(updates []SQLUpdate) ([]int64, []int64, error) {
+	return r.ExecuteUpdatesContext(context.Background(), updates)
+}
+
+// ExecuteUpdatesContext is ExecuteUpdates running in the transaction carried by ctx, if any.
+func (r *RDSPooledConnection) ExecuteUpdatesContext(ctx context.Context, updates []SQLUpdate) ([]int64, []int64, error) {
 	if len(updates) == 0 {
 		return []int64{}, []int64{}, nil
 	}
 
-	var cnx *sql.Conn
-	var err error
 	var rowCounts []int64
 	var newRowIDs []int64
 
-	txManager := r.txManagerPool.GetTransactionManager()
-	if txManager == nil {
-		cnx, err = r.cnxPool.Conn(context.Background())
+	// Several statements share one pinned connection, as their session state may depend
+	// on each other; only a lone statement may go through the statement cache.
+	single := len(updates) == 1 && len(updates[0].Values) <= 1
+	ctx, cnx, release, err := r.acquire(ctx, single)
+	if err != nil {
+		return nil, nil, dberrors.Classify(err, updates[0].SQL, 0)
+	}
+	defer release()
+
+	for i, update := range updates {
+		counts, ids, err := r.executeUpdate(ctx, cnx, update)
+		if err != nil {
+			return nil, nil, dberrors.Classify(err, update.SQL, i)
+		}
+		rowCounts = append(rowCounts, counts...)
+		newRowIDs = append(newRowIDs, ids...)
+	}
+
+	return rowCounts, newRowIDs, nil
+}
+
+func (r *RDSPooledConnection) executeUpdate(ctx context.Context, cnx preparer, update SQLUpdate) (rowCounts []int64, newRowIDs []int64, err error) {
+	if r.maxAllowedPacket > 0 && len(update.Values) > 1 {
+		if batch, ok := parseBatchInsert(update.SQL, update.Values); ok {
+			return r.executeBatchInsert(ctx, cnx, batch, update.Values)
+		}
+	}
+
+	stmt, done, err := r.prepare(ctx, cnx, update.SQL)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { done(err) }()
+
+	values := update.Values
+	if values == nil {
+		values = [][]interface{}{nil}
+	}
+
+	for _, row := range values {
+		res, err := stmt.ExecContext(ctx, row...)
 		if err != nil {
-			log.Printf("Error getting connection: %v", err)
 			return nil, nil, err
 		}
-	} else {
-		// Use transaction from the transaction manager
-		cnx, _ = txManager.GetConnection()
-	}
-	defer cnx.Close()
-	for _, update := range updates {
-		var stmt *sql.Stmt
-		stmt, err = cnx.PrepareContext(context.Background(), update.SQL)
+
+		rowCount, err := res.RowsAffected()
 		if err != nil {
-			log.Printf("Error preparing update: %v", err)
 			return nil, nil, err
 		}
+		rowCounts = append(rowCounts, rowCount)
 
-		if update.Values == nil {
-			res, err := stmt.Exec()
-			if err != nil {
-				return nil, nil, err
-			}
-
-			rowCount, err := res.RowsAffected()
-			if err != nil {
-				return nil, nil, err
-			}
-			rowCounts = append(rowCounts, rowCount)
-
-			newRowID, err := res.LastInsertId()
-			if err != nil {
-				newRowIDs = append(newRowIDs, 0) // Add 0 if no last ID is returned
-			} else {
-				newRowIDs = append(newRowIDs, newRowID)
-			}
+		newRowID, err := res.LastInsertId()
+		if err != nil {
+			newRowIDs = append(newRowIDs, 0) // Add 0 if no last ID is returned
 		} else {
-			for _, values := range update.Values {
-				res, err := stmt.Exec(values...)
-				if err != nil {
-					return nil, nil, err
-				}
-
-				rowCount, err := res.RowsAffected()
-				if err != nil {
-					return nil, nil, err
-				}
-				rowCounts = append(rowCounts, rowCount)
-
-				newRowID, err := res.LastInsertId()
-				if err != nil {
-					newRowIDs = append(newRowIDs, 0)
-				} else {
-					newRowIDs = append(newRowIDs, newRowID)
-				}
-			}
+			newRowIDs = append(newRowIDs, newRowID)
 		}
-		stmt.Close()
 	}
 
 	return rowCounts, newRowIDs, nil
 }
 
 func (r *RDSPooledConnection) ExecuteFunctions(updateFunctions []func() error) error {
-	r.txManagerPool.Register()
+	return r.ExecuteFunctionsWithOptions(TxOptions{}, updateFunctions)
+}
+
+// ExecuteFunctionsWithOptions is ExecuteFunctions with the transaction begun with opts.
+func (r *RDSPooledConnection) ExecuteFunctionsWithOptions(opts TxOptions, updateFunctions []func() error) error {
+	return r.executeFunctions(context.Background(), opts, updateFunctions)
+}
+
+// ExecuteFunctionsWithOptionsContext is ExecuteFunctionsContext with the transaction
+// begun with opts.
+func (r *RDSPooledConnection) ExecuteFunctionsWithOptionsContext(ctx context.Context, opts TxOptions, updateFunctions []func() error) error {
+	return r.executeFunctions(ctx, opts, updateFunctions)
+}
+
+// ExecuteFunctionsContext is ExecuteFunctions bound to ctx. Once ctx is done the running
+// statement is cancelled, the remaining functions are skipped, the transaction is
+// rolled back and ctx.Err(), e.g. context.DeadlineExceeded, is returned. This includes
+// statements the functions run through ExecuteQuery or ExecuteUpdates without a
+// context of their own. If ctx carries a transaction, e.g. inside WithTransaction, the
+// functions join it instead of beginning their own.
+func (r *RDSPooledConnection) ExecuteFunctionsContext(ctx context.Context, updateFunctions []func() error) error {
+	return r.executeFunctions(ctx, TxOptions{}, updateFunctions)
+}
+
+func (r *RDSPooledConnection) executeFunctions(ctx context.Context, opts TxOptions, updateFunctions []func() error) error {
+	if txManager, ok := r.txManagerPool.contextTransaction(ctx); ok {
+		// Join the transaction ctx carries, as WithTransaction does.
+		return r.txManagerPool.joinContextTransaction(ctx, txManager, opts, r.txManagerPool.nested, func(ctx context.Context) error {
+			return runFunctions(ctx, updateFunctions)
+		})
+	}
+	if _, active := r.activeTransactionManager(ctx); !active {
+		// ctx bypasses the goroutine's transaction, if one is registered.
+		defer r.txManagerPool.resume(r.txManagerPool.suspend())
+	}
+
+	if err := r.txManagerPool.RegisterContext(ctx, opts); err != nil {
+		return err
+	}
 
 	defer func() {
 		if rec := recover(); rec != nil {
-			r.txManagerPool.Release(false)
+			r.txManagerPool.release(false, panicCause(rec))
 			panic(rec)
 		}
 	}()
 
+	if err := runFunctions(ctx, updateFunctions); err != nil {
+		r.txManagerPool.release(false, err)
+		return err
+	}
+	return r.txManagerPool.ReleaseContext(ctx, true)
+}
+
+// runFunctions calls updateFunctions in order until one fails or ctx is done.
+func runFunctions(ctx context.Context, updateFunctions []func() error) error {
 	for _, updateFunc := range updateFunctions {
-		err := updateFunc()
+		err := ctx.Err()
+		if err == nil {
+			err = updateFunc()
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = ctxErr
+		}
 		if err != nil {
-			r.txManagerPool.Release(false)
 			return err
 		}
 	}
-
-	return r.txManagerPool.Release(true)
+	return nil
 }
@@ -0,0 +1,103 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/anmollp/generic-db-go/src/dberrors"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecuteUpdatesClassifiesErrors(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	fdb.onExec = func(query string, args []driver.Value) (driver.Result, error) {
+		if query == "INSERT INTO users (email) VALUES (?)" {
+			return nil, &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'a@b.c' for key 'users.email'"}
+		}
+		return driver.RowsAffected(1), nil
+	}
+
+	_, _, err := rds.ExecuteUpdates([]SQLUpdate{
+		{SQL: "UPDATE users SET name = ?", Values: [][]interface{}{{"x"}}},
+		{SQL: "INSERT INTO users (email) VALUES (?)", Values: [][]interface{}{{"a@b.c"}}},
+	})
+
+	var dbErr *dberrors.Error
+	assert.ErrorIs(t, err, dberrors.ErrDuplicateKey)
+	if assert.ErrorAs(t, err, &dbErr) {
+		assert.Equal(t, "INSERT INTO users (email) VALUES (?)", dbErr.SQL)
+		assert.Equal(t, 1, dbErr.Index)
+		assert.Equal(t, "users.email", dbErr.Key)
+	}
+}
+
+func TestExecuteUpdatesClassifiesBatchedInsertErrors(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	rds.SetInsertBatching(DefaultMaxAllowedPacket)
+	failFirstExecs(fdb, 1, &mysql.MySQLError{Number: 1452, Message: "Cannot add or update a child row"})
+
+	_, _, err := rds.ExecuteUpdates([]SQLUpdate{{SQL: "INSERT INTO orders (user_id) VALUES (?)", Values: [][]interface{}{{1}, {2}}}})
+
+	var dbErr *dberrors.Error
+	assert.ErrorIs(t, err, dberrors.ErrForeignKeyViolation)
+	if assert.ErrorAs(t, err, &dbErr) {
+		assert.Equal(t, "INSERT INTO orders (user_id) VALUES (?)", dbErr.SQL)
+		assert.Equal(t, 0, dbErr.Index)
+	}
+}
+
+func TestExecuteQueryClassifiesErrors(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	fdb.onQuery = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		return nil, nil, &mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"}
+	}
+
+	_, err := rds.ExecuteQuery("SELECT * FROM users FOR UPDATE", nil, false)
+	assert.ErrorIs(t, err, dberrors.ErrLockTimeout)
+	assert.True(t, IsRetryable(err))
+
+	_, err = rds.QueryCursor(context.Background(), "SELECT * FROM users FOR UPDATE", nil)
+	assert.ErrorIs(t, err, dberrors.ErrLockTimeout)
+}
+
+func TestExecuteQueryLeavesOtherErrorsAlone(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	syntaxErr := &mysql.MySQLError{Number: 1064, Message: "You have an error in your SQL syntax"}
+	fdb.onQuery = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		return nil, nil, syntaxErr
+	}
+
+	_, err := rds.ExecuteQuery("SELEC 1", nil, false)
+
+	assert.Equal(t, syntaxErr, err)
+}
+
+func TestFailedStatementsAreNotLogged(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	deadlock := &mysql.MySQLError{Number: 1213, Message: "Deadlock found"}
+	fdb.onExec = func(query string, args []driver.Value) (driver.Result, error) { return nil, deadlock }
+	fdb.onQuery = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) { return nil, nil, deadlock }
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	_, _, err := rds.ExecuteUpdates([]SQLUpdate{{SQL: "UPDATE t SET n = 1"}})
+	assert.ErrorIs(t, err, dberrors.ErrDeadlock)
+	_, err = rds.ExecuteQuery("SELECT n FROM t FOR UPDATE", nil, false)
+	assert.ErrorIs(t, err, dberrors.ErrDeadlock)
+	_, err = rds.QueryCursor(context.Background(), "SELECT n FROM t FOR UPDATE", nil)
+	assert.ErrorIs(t, err, dberrors.ErrDeadlock)
+
+	assert.Empty(t, logs.String(), "errors are returned to the caller, not logged")
+}
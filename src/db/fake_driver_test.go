@@ -0,0 +1,240 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeDriver is an in-memory database/sql driver that records every statement
+// and transaction event, so transaction behaviour can be tested without MySQL.
+type fakeDriver struct {
+	mu        sync.Mutex
+	databases map[string]*fakeDatabase
+}
+
+var fakeDrv = &fakeDriver{databases: map[string]*fakeDatabase{}}
+
+func init() {
+	sql.Register("fakedb", fakeDrv)
+}
+
+type fakeDatabase struct {
+	mu      sync.Mutex
+	events  []string
+	nextID  int64
+	conns   int64
+	onExec  func(query string, args []driver.Value) (driver.Result, error)
+	onQuery func(query string, args []driver.Value) ([]string, [][]driver.Value, error)
+	onPing  func() error
+	// columnTypes holds the database type name reported for each column name.
+	columnTypes map[string]string
+	// delay makes every exec take this long, unless its context ends first.
+	delay time.Duration
+}
+
+// newFakePool returns a connection pool backed by a fresh fakeDatabase.
+func newFakePool(t *testing.T) (*sql.DB, *fakeDatabase) {
+	t.Helper()
+	return newNamedFakePool(t, t.Name())
+}
+
+// newNamedFakePool is newFakePool for tests that need several databases.
+func newNamedFakePool(t *testing.T, name string) (*sql.DB, *fakeDatabase) {
+	t.Helper()
+	fdb := &fakeDatabase{}
+	fakeDrv.mu.Lock()
+	fakeDrv.databases[name] = fdb
+	fakeDrv.mu.Unlock()
+
+	pool, err := sql.Open("fakedb", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pool.Close() })
+	return pool, fdb
+}
+
+// Events returns the recorded events, each prefixed with the id of the connection it ran on.
+func (f *fakeDatabase) Events() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.events...)
+}
+
+// Statements returns the recorded events without their connection ids.
+func (f *fakeDatabase) Statements() []string {
+	var statements []string
+	for _, event := range f.Events() {
+		statements = append(statements, event[strings.Index(event, " ")+1:])
+	}
+	return statements
+}
+
+func (f *fakeDatabase) record(connID int64, format string, args ...interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, fmt.Sprintf("c%d ", connID)+fmt.Sprintf(format, args...))
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	fdb, ok := d.databases[name]
+	d.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown fake database %q", name)
+	}
+	return &fakeConn{db: fdb, id: atomic.AddInt64(&fdb.conns, 1)}, nil
+}
+
+type fakeConn struct {
+	db *fakeDatabase
+	id int64
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Ping(ctx context.Context) error {
+	if c.db.onPing != nil {
+		return c.db.onPing()
+	}
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *fakeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	event := "BEGIN"
+	if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) {
+		event += " " + sql.IsolationLevel(opts.Isolation).String()
+	}
+	if opts.ReadOnly {
+		event += " READ ONLY"
+	}
+	c.db.record(c.id, event)
+	return &fakeTx{conn: c}, nil
+}
+
+type fakeTx struct {
+	conn *fakeConn
+}
+
+func (tx *fakeTx) Commit() error {
+	tx.conn.db.record(tx.conn.id, "COMMIT")
+	return nil
+}
+
+func (tx *fakeTx) Rollback() error {
+	tx.conn.db.record(tx.conn.id, "ROLLBACK")
+	return nil
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	fdb := s.conn.db
+	fdb.record(s.conn.id, "%s %v", s.query, args)
+	if fdb.onExec != nil {
+		return fdb.onExec(s.query, args)
+	}
+	return fakeResult{lastInsertID: atomic.AddInt64(&fdb.nextID, 1), rowsAffected: 1}, nil
+}
+
+func (s *fakeStmt) ExecContext(ctx context.Context, named []driver.NamedValue) (driver.Result, error) {
+	args := make([]driver.Value, len(named))
+	for i, arg := range named {
+		args[i] = arg.Value
+	}
+	if delay := s.conn.db.delay; delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			s.conn.db.record(s.conn.id, "%s %v", s.query, args)
+			return nil, ctx.Err()
+		}
+	}
+	return s.Exec(args)
+}
+
+type fakeResult struct {
+	lastInsertID int64
+	rowsAffected int64
+}
+
+func (r fakeResult) LastInsertId() (int64, error) {
+	return r.lastInsertID, nil
+}
+
+func (r fakeResult) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	fdb := s.conn.db
+	fdb.record(s.conn.id, "%s %v", s.query, args)
+	if fdb.onQuery == nil {
+		return &fakeRows{}, nil
+	}
+	columns, values, err := fdb.onQuery(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	types := make([]string, len(columns))
+	for i, column := range columns {
+		types[i] = fdb.columnTypes[column]
+	}
+	return &fakeRows{columns: columns, types: types, values: values}, nil
+}
+
+type fakeRows struct {
+	columns []string
+	types   []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) ColumnTypeDatabaseTypeName(index int) string {
+	return r.types[index]
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
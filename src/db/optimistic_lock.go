@@ -0,0 +1,81 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ErrStaleVersion is matched by the *StaleVersionError UpdateWithVersion returns when
+// the row was changed or deleted since the expected version was read.
+var ErrStaleVersion = errors.New("stale row version")
+
+// StaleVersionError reports that no row of Table with ID was at Version.
+type StaleVersionError struct {
+	Table   string
+	ID      interface{}
+	Version int64
+}
+
+func (e *StaleVersionError) Error() string {
+	return fmt.Sprintf("%v: %s row %v is no longer at version %d", ErrStaleVersion, e.Table, e.ID, e.Version)
+}
+
+func (e *StaleVersionError) Is(target error) bool {
+	return target == ErrStaleVersion
+}
+
+// identifier matches the table and column names UpdateWithVersion puts into its SQL.
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// UpdateWithVersion sets values on the row of table whose id column is id, provided its
+// version column still holds version, and increments the version. It returns the new
+// version, or a *StaleVersionError matching ErrStaleVersion if no row was updated.
+// Inside a registered transaction the update runs in that transaction.
+func (r *RDSPooledConnection) UpdateWithVersion(table string, id interface{}, version int64, values map[string]interface{}) (int64, error) {
+	return r.UpdateWithVersionContext(context.Background(), table, id, version, values)
+}
+
+// UpdateWithVersionContext is UpdateWithVersion running in the transaction carried by ctx, if any.
+func (r *RDSPooledConnection) UpdateWithVersionContext(ctx context.Context, table string, id interface{}, version int64, values map[string]interface{}) (int64, error) {
+	if !identifier.MatchString(table) {
+		return 0, fmt.Errorf("invalid table name %q", table)
+	}
+
+	columns := make([]string, 0, len(values))
+	for column := range values {
+		if !identifier.MatchString(column) || strings.Contains(column, ".") {
+			return 0, fmt.Errorf("invalid column name %q", column)
+		}
+		if column == "id" || column == "version" {
+			return 0, fmt.Errorf("column %q cannot be set by UpdateWithVersion", column)
+		}
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	var set strings.Builder
+	args := make([]interface{}, 0, len(columns)+2)
+	for _, column := range columns {
+		set.WriteString(column + " = ?, ")
+		args = append(args, values[column])
+	}
+	args = append(args, id, version)
+
+	rowCounts, _, err := r.ExecuteUpdatesContext(ctx, []SQLUpdate{{
+		SQL:    "UPDATE " + table + " SET " + set.String() + "version = version + 1 WHERE id = ? AND version = ?",
+		Values: [][]interface{}{args},
+	}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to update %s row %v: %w", table, id, err)
+	}
+	// The version always changes, so MySQL reports the row as affected even when
+	// values leave the other columns as they were.
+	if rowCounts[0] == 0 {
+		return 0, &StaleVersionError{Table: table, ID: id, Version: version}
+	}
+	return version + 1, nil
+}
@@ -0,0 +1,51 @@
+package db
+
+import (
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateWithVersion(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+
+	newVersion, err := rds.UpdateWithVersion("accounts", 7, 3, map[string]interface{}{"owner": "bob", "balance": 10})
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), newVersion)
+	assert.Equal(t, []string{
+		"UPDATE accounts SET balance = ?, owner = ?, version = version + 1 WHERE id = ? AND version = ? [10 bob 7 3]",
+	}, fdb.Statements())
+}
+
+func TestUpdateWithVersionStale(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	fdb.onExec = func(query string, args []driver.Value) (driver.Result, error) {
+		return driver.RowsAffected(0), nil
+	}
+
+	_, err := rds.UpdateWithVersion("accounts", 7, 3, map[string]interface{}{"balance": 10})
+
+	assert.ErrorIs(t, err, ErrStaleVersion)
+	var staleErr *StaleVersionError
+	if assert.True(t, errors.As(err, &staleErr)) {
+		assert.Equal(t, &StaleVersionError{Table: "accounts", ID: 7, Version: 3}, staleErr)
+	}
+}
+
+func TestUpdateWithVersionRejectsUnsafeNames(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+
+	_, err := rds.UpdateWithVersion("accounts; DROP TABLE x", 1, 1, map[string]interface{}{"a": 1})
+	assert.Error(t, err)
+	_, err = rds.UpdateWithVersion("accounts", 1, 1, map[string]interface{}{"a = 1, b": 1})
+	assert.Error(t, err)
+	_, err = rds.UpdateWithVersion("accounts", 1, 1, map[string]interface{}{"version": 9})
+	assert.Error(t, err)
+	assert.Empty(t, fdb.Statements())
+}
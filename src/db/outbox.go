@@ -0,0 +1,221 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrOutboxOutsideTransaction is returned by Outbox.Publish when no transaction is
+// active, where the event would be stored even if the caller's work failed.
+var ErrOutboxOutsideTransaction = errors.New("outbox events must be published inside a transaction")
+
+// OutboxMessage is an event stored in the outbox table.
+type OutboxMessage struct {
+	ID      int64
+	Topic   string
+	Payload []byte
+}
+
+// Outbox writes events to an outbox table in the caller's transaction, so an event is
+// stored if and only if the transaction that produced it commits. A Relay delivers
+// them afterwards. The table must have at least these columns:
+//
+//	CREATE TABLE outbox (
+//		id      BIGINT AUTO_INCREMENT PRIMARY KEY,
+//		topic   VARCHAR(255) NOT NULL,
+//		payload BLOB NOT NULL,
+//		sent_at TIMESTAMP NULL,
+//		KEY (sent_at, id)
+//	)
+type Outbox struct {
+	rds   *RDSPooledConnection
+	table string
+}
+
+// NewOutbox creates an Outbox writing to table through rds. table is put into the SQL
+// as is, so it must not come from user input.
+func NewOutbox(rds *RDSPooledConnection, table string) *Outbox {
+	return &Outbox{rds: rds, table: table}
+}
+
+// Publish stores an event in the transaction registered for the current goroutine, e.g.
+// from a function run by ExecuteFunctions. It returns ErrOutboxOutsideTransaction
+// outside of a transaction.
+func (o *Outbox) Publish(topic string, payload []byte) error {
+	return o.PublishContext(context.Background(), topic, payload)
+}
+
+// PublishContext is Publish storing the event in the transaction carried by ctx, if any.
+func (o *Outbox) PublishContext(ctx context.Context, topic string, payload []byte) error {
+	if _, ok := o.rds.activeTransactionManager(ctx); !ok {
+		return ErrOutboxOutsideTransaction
+	}
+
+	_, _, err := o.rds.ExecuteUpdatesContext(ctx, []SQLUpdate{{
+		SQL:    "INSERT INTO " + o.table + " (topic, payload) VALUES (?, ?)",
+		Values: [][]interface{}{{topic, payload}},
+	}})
+	if err != nil {
+		return fmt.Errorf("failed to publish to outbox: %w", err)
+	}
+	return nil
+}
+
+// Publisher delivers outbox events to a message broker.
+type Publisher interface {
+	Publish(ctx context.Context, msg OutboxMessage) error
+}
+
+// Relay moves unsent events from an Outbox to a Publisher. Events are delivered at
+// least once: one published just before a crash is published again on restart.
+// Several relays may run against the same table; rows are locked with SKIP LOCKED
+// so each batch goes to one relay only.
+type Relay struct {
+	outbox    *Outbox
+	publisher Publisher
+
+	// BatchSize is the maximum number of events delivered per transaction.
+	BatchSize int
+	// Interval is how long Run waits before polling again once the outbox is drained.
+	Interval time.Duration
+}
+
+// NewRelay creates a Relay delivering events from outbox to publisher, 100 at a time,
+// polling every second.
+func NewRelay(outbox *Outbox, publisher Publisher) *Relay {
+	return &Relay{
+		outbox:    outbox,
+		publisher: publisher,
+		BatchSize: 100,
+		Interval:  time.Second,
+	}
+}
+
+// RelayOnce delivers one batch of unsent events in order and marks them sent, returning
+// how many were delivered. If publishing an event fails the events before it are still
+// marked sent and the error is returned.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	var sent int
+	var publishErr error
+
+	err := r.outbox.rds.WithTransaction(ctx, func(ctx context.Context) error {
+		result, err := r.outbox.rds.ExecuteQueryContext(ctx,
+			"SELECT id, topic, payload FROM "+r.outbox.table+
+				" WHERE sent_at IS NULL ORDER BY id LIMIT ? FOR UPDATE SKIP LOCKED",
+			[]interface{}{r.BatchSize}, false)
+		if err != nil {
+			return fmt.Errorf("failed to read outbox: %w", err)
+		}
+
+		var ids []interface{}
+		for _, row := range result.([]map[string]interface{}) {
+			msg, err := outboxMessageFromRow(row)
+			if err != nil {
+				return err
+			}
+			if err := r.publisher.Publish(ctx, msg); err != nil {
+				publishErr = fmt.Errorf("failed to publish outbox message %d: %w", msg.ID, err)
+				break
+			}
+			ids = append(ids, msg.ID)
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+		_, _, err = r.outbox.rds.ExecuteUpdatesContext(ctx, []SQLUpdate{{
+			SQL:    "UPDATE " + r.outbox.table + " SET sent_at = CURRENT_TIMESTAMP WHERE id IN (" + placeholders + ")",
+			Values: [][]interface{}{ids},
+		}})
+		if err != nil {
+			return fmt.Errorf("failed to mark outbox messages sent: %w", err)
+		}
+		sent = len(ids)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return sent, publishErr
+}
+
+// Run calls RelayOnce until ctx is done, polling again straight away while batches
+// come back full and waiting Interval otherwise. Errors are logged and retried after
+// Interval. It returns ctx.Err().
+func (r *Relay) Run(ctx context.Context) error {
+	for {
+		sent, err := r.RelayOnce(ctx)
+		if err != nil {
+			log.Printf("Error relaying outbox: %v", err)
+		}
+		if err != nil || sent < r.BatchSize {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(r.Interval):
+			}
+		} else if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// outboxMessageFromRow converts a row read by ExecuteQuery into an OutboxMessage.
+func outboxMessageFromRow(row map[string]interface{}) (OutboxMessage, error) {
+	var msg OutboxMessage
+	switch id := row["id"].(type) {
+	case int64:
+		msg.ID = id
+	case []byte:
+		parsed, err := strconv.ParseInt(string(id), 10, 64)
+		if err != nil {
+			return OutboxMessage{}, fmt.Errorf("invalid outbox id %q: %w", id, err)
+		}
+		msg.ID = parsed
+	default:
+		return OutboxMessage{}, fmt.Errorf("invalid outbox id %v", row["id"])
+	}
+
+	switch topic := row["topic"].(type) {
+	case string:
+		msg.Topic = topic
+	case []byte:
+		msg.Topic = string(topic)
+	}
+	switch payload := row["payload"].(type) {
+	case string:
+		msg.Payload = []byte(payload)
+	case []byte:
+		msg.Payload = append([]byte(nil), payload...)
+	}
+	return msg, nil
+}
+
+// InMemoryPublisher is a Publisher keeping every event in memory, for tests.
+type InMemoryPublisher struct {
+	mu       sync.Mutex
+	messages []OutboxMessage
+}
+
+func (p *InMemoryPublisher) Publish(ctx context.Context, msg OutboxMessage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.messages = append(p.messages, msg)
+	return nil
+}
+
+// Messages returns the events published so far, in order.
+func (p *InMemoryPublisher) Messages() []OutboxMessage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]OutboxMessage(nil), p.messages...)
+}
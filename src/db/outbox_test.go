@@ -0,0 +1,115 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutboxPublishRequiresTransaction(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	outbox := NewOutbox(NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool)), "outbox")
+
+	err := outbox.Publish("orders.created", []byte("1"))
+
+	assert.ErrorIs(t, err, ErrOutboxOutsideTransaction)
+	assert.Empty(t, fdb.Statements())
+}
+
+func TestOutboxPublishJoinsTransaction(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	outbox := NewOutbox(rds, "outbox")
+
+	err := rds.ExecuteFunctions([]func() error{
+		execUpdate(rds, "INSERT INTO orders VALUES (1)"),
+		func() error { return outbox.Publish("orders.created", []byte("1")) },
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"BEGIN",
+		"INSERT INTO orders VALUES (1) []",
+		"INSERT INTO outbox (topic, payload) VALUES (?, ?) [orders.created [49]]",
+		"COMMIT",
+	}, fdb.Statements())
+}
+
+// unsentRows makes the fake database return the given topics as unsent outbox rows.
+func unsentRows(fdb *fakeDatabase, topics ...string) {
+	fdb.onQuery = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		var rows [][]driver.Value
+		for i, topic := range topics {
+			rows = append(rows, []driver.Value{int64(i + 1), []byte(topic), []byte(topic + "-payload")})
+		}
+		return []string{"id", "topic", "payload"}, rows, nil
+	}
+}
+
+func TestRelayOnceDeliversAndMarksSent(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	outbox := NewOutbox(NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool)), "outbox")
+	publisher := &InMemoryPublisher{}
+	unsentRows(fdb, "a", "b")
+
+	sent, err := NewRelay(outbox, publisher).RelayOnce(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, sent)
+	assert.Equal(t, []OutboxMessage{
+		{ID: 1, Topic: "a", Payload: []byte("a-payload")},
+		{ID: 2, Topic: "b", Payload: []byte("b-payload")},
+	}, publisher.Messages())
+	assert.Equal(t, []string{
+		"BEGIN",
+		"SELECT id, topic, payload FROM outbox WHERE sent_at IS NULL ORDER BY id LIMIT ? FOR UPDATE SKIP LOCKED [100]",
+		"UPDATE outbox SET sent_at = CURRENT_TIMESTAMP WHERE id IN (?, ?) [1 2]",
+		"COMMIT",
+	}, fdb.Statements())
+}
+
+// failingPublisher fails for one topic and hands everything else to an InMemoryPublisher.
+type failingPublisher struct {
+	InMemoryPublisher
+	topic string
+}
+
+func (p *failingPublisher) Publish(ctx context.Context, msg OutboxMessage) error {
+	if msg.Topic == p.topic {
+		return errors.New("broker unavailable")
+	}
+	return p.InMemoryPublisher.Publish(ctx, msg)
+}
+
+func TestRelayOnceMarksDeliveredEventsBeforeFailure(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	outbox := NewOutbox(NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool)), "outbox")
+	publisher := &failingPublisher{topic: "b"}
+	unsentRows(fdb, "a", "b", "c")
+
+	sent, err := NewRelay(outbox, publisher).RelayOnce(context.Background())
+
+	assert.ErrorContains(t, err, "failed to publish outbox message 2")
+	assert.Equal(t, 1, sent)
+	assert.Len(t, publisher.Messages(), 1)
+	statements := fdb.Statements()
+	assert.Contains(t, statements, "UPDATE outbox SET sent_at = CURRENT_TIMESTAMP WHERE id IN (?) [1]")
+	assert.Equal(t, "COMMIT", statements[len(statements)-1])
+}
+
+func TestRelayOnceWithEmptyOutbox(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	outbox := NewOutbox(NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool)), "outbox")
+
+	sent, err := NewRelay(outbox, &InMemoryPublisher{}).RelayOnce(context.Background())
+
+	assert.NoError(t, err)
+	assert.Zero(t, sent)
+	for _, statement := range fdb.Statements() {
+		assert.False(t, strings.HasPrefix(statement, "UPDATE"), statement)
+	}
+}
@@ -0,0 +1,313 @@
+package db
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anmollp/generic-db-go/src/filters"
+)
+
+// ErrInvalidPageToken is returned for a page token that was altered or issued by a
+// paginator with another key, query, filter or order.
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+// Page is one page of rows from a Paginator. Next and Previous are tokens for the
+// neighbouring pages, empty when there is no such page.
+type Page struct {
+	Rows     []map[string]interface{}
+	Next     string
+	Previous string
+}
+
+// Paginator pages through a query with keyset (seek) pagination: instead of skipping
+// rows with OFFSET, each page selects the rows after the last one of the page before,
+// which an index on the sort columns finds directly however deep the page is.
+//
+//	paginator, err := db.NewPaginator(rds, key, "SELECT id, name, created_at FROM users",
+//		filters.Equals{Column: "status", Value: "active"},
+//		[]filters.SortColumn{{Column: "created_at", Descending: true}, {Column: "id"}}, 50)
+//	page, err := paginator.Page(ctx, "")
+//	next, err := paginator.Page(ctx, page.Next)
+//
+// Tokens are signed with key, so clients can hold on to them but not forge or alter
+// them.
+type Paginator struct {
+	rds      *RDSPooledConnection
+	key      []byte
+	query    string
+	filter   filters.Filter
+	order    []filters.SortColumn
+	pageSize int
+}
+
+// NewPaginator returns a Paginator over query, a SELECT without WHERE, ORDER BY or
+// LIMIT clauses, restricted by filter if it is not nil. Rows are sorted by order, whose
+// columns must be selected by query, must not be NULL and together must identify a row,
+// typically by ending with the primary key. key signs page tokens and must be the
+// same on every instance serving them.
+func NewPaginator(rds *RDSPooledConnection, key []byte, query string, filter filters.Filter, order []filters.SortColumn, pageSize int) (*Paginator, error) {
+	if len(key) == 0 {
+		return nil, errors.New("paginator key must not be empty")
+	}
+	if len(order) == 0 {
+		return nil, errors.New("paginator needs at least one sort column")
+	}
+	for _, column := range order {
+		if !identifier.MatchString(column.Column) {
+			return nil, fmt.Errorf("invalid column name %q", column.Column)
+		}
+	}
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("invalid page size %d", pageSize)
+	}
+
+	return &Paginator{
+		rds:      rds,
+		key:      key,
+		query:    query,
+		filter:   filter,
+		order:    order,
+		pageSize: pageSize,
+	}, nil
+}
+
+// Page returns the page token points to, or the first page if token is empty. Like
+// ExecuteQueryContext it runs in the transaction carried by ctx, if any.
+func (p *Paginator) Page(ctx context.Context, token string) (Page, error) {
+	var cursor pageCursor
+	if token != "" {
+		var err error
+		if cursor, err = p.decodeToken(token); err != nil {
+			return Page{}, err
+		}
+	}
+
+	order := p.order
+	if cursor.Backward {
+		order = reverseOrder(p.order)
+	}
+	sqlQuery, params := p.pageQuery(order, cursor.Values)
+
+	var rows []map[string]interface{}
+	err := p.rds.queryRows(ctx, sqlQuery, params, func(r *sql.Rows) error {
+		var err error
+		rows, err = scanRowMaps(r, p.rds.typeMapping)
+		return err
+	})
+	if err != nil {
+		return Page{}, err
+	}
+
+	more := len(rows) > p.pageSize
+	if more {
+		rows = rows[:p.pageSize]
+	}
+	if cursor.Backward {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+
+	page := Page{Rows: rows}
+	if len(rows) == 0 {
+		return page, nil
+	}
+	// Going forward there are rows after this page if more were found, and rows before
+	// it unless it is the first page; going backward it is the other way around.
+	hasNext, hasPrevious := more, token != ""
+	if cursor.Backward {
+		hasNext, hasPrevious = true, more
+	}
+	if hasNext {
+		if page.Next, err = p.encodeToken(false, rows[len(rows)-1]); err != nil {
+			return Page{}, err
+		}
+	}
+	if hasPrevious {
+		if page.Previous, err = p.encodeToken(true, rows[0]); err != nil {
+			return Page{}, err
+		}
+	}
+	return page, nil
+}
+
+// pageQuery returns the query for one page plus one row sorted by order, after the
+// row whose sort values are seek unless seek is nil.
+func (p *Paginator) pageQuery(order []filters.SortColumn, seek []interface{}) (string, []interface{}) {
+	var conditions []string
+	var params []interface{}
+	if p.filter != nil && p.filter.GetSQL() != "" {
+		conditions = append(conditions, "("+p.filter.GetSQL()+")")
+		params = append(params, p.filter.GetParams()...)
+	}
+	if seek != nil {
+		seekFilter := filters.Seek{Columns: order, Values: seek}
+		conditions = append(conditions, seekFilter.GetSQL())
+		params = append(params, seekFilter.GetParams()...)
+	}
+
+	sqlQuery := p.query
+	if len(conditions) > 0 {
+		sqlQuery += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	sortKeys := make([]string, len(order))
+	for i, column := range order {
+		sortKeys[i] = column.Column
+		if column.Descending {
+			sortKeys[i] += " DESC"
+		}
+	}
+	sqlQuery += fmt.Sprintf(" ORDER BY %s LIMIT %d", strings.Join(sortKeys, ", "), p.pageSize+1)
+	return sqlQuery, params
+}
+
+func reverseOrder(order []filters.SortColumn) []filters.SortColumn {
+	reversed := make([]filters.SortColumn, len(order))
+	for i, column := range order {
+		reversed[i] = filters.SortColumn{Column: column.Column, Descending: !column.Descending}
+	}
+	return reversed
+}
+
+// pageCursor is the content of a page token: the sort values of the row to continue
+// from, and whether the page wanted lies before it.
+type pageCursor struct {
+	Backward bool          `json:"b,omitempty"`
+	Values   []interface{} `json:"-"`
+	Encoded  []tokenValue  `json:"v"`
+}
+
+// tokenValue is a sort value tagged with its Go type, so it is passed back to the
+// database as the same type it was read as.
+type tokenValue struct {
+	Type  string `json:"t"`
+	Value string `json:"v"`
+}
+
+// encodeToken returns the signed token continuing from row in the given direction.
+func (p *Paginator) encodeToken(backward bool, row map[string]interface{}) (string, error) {
+	cursor := pageCursor{Backward: backward}
+	for _, column := range p.order {
+		name := column.Column[strings.LastIndex(column.Column, ".")+1:]
+		value, ok := row[name]
+		if !ok {
+			return "", fmt.Errorf("sort column %s is not among the query's columns", column.Column)
+		}
+		encoded, err := encodeTokenValue(value)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode sort column %s: %w", column.Column, err)
+		}
+		cursor.Encoded = append(cursor.Encoded, encoded)
+	}
+
+	payload, err := json.Marshal(cursor)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode page token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(p.sign(payload)), nil
+}
+
+// decodeToken verifies token's signature and returns the cursor it holds.
+func (p *Paginator) decodeToken(token string) (pageCursor, error) {
+	encodedPayload, encodedMAC, ok := strings.Cut(token, ".")
+	if !ok {
+		return pageCursor{}, ErrInvalidPageToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return pageCursor{}, ErrInvalidPageToken
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil || !hmac.Equal(mac, p.sign(payload)) {
+		return pageCursor{}, ErrInvalidPageToken
+	}
+
+	var cursor pageCursor
+	if err := json.Unmarshal(payload, &cursor); err != nil || len(cursor.Encoded) != len(p.order) {
+		return pageCursor{}, ErrInvalidPageToken
+	}
+	for _, encoded := range cursor.Encoded {
+		value, err := decodeTokenValue(encoded)
+		if err != nil {
+			return pageCursor{}, ErrInvalidPageToken
+		}
+		cursor.Values = append(cursor.Values, value)
+	}
+	return cursor, nil
+}
+
+// sign returns the MAC of payload, bound to the paginator's query, filter and order so
+// a token cannot be replayed against a different listing.
+func (p *Paginator) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(p.query))
+	mac.Write([]byte{0})
+	if p.filter != nil {
+		mac.Write([]byte(p.filter.GetSQL()))
+		mac.Write([]byte{0})
+		paramsJSON, _ := json.Marshal(p.filter.GetParams())
+		mac.Write(paramsJSON)
+	}
+	mac.Write([]byte{0})
+	orderJSON, _ := json.Marshal(p.order)
+	mac.Write(orderJSON)
+	mac.Write([]byte{0})
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+func encodeTokenValue(value interface{}) (tokenValue, error) {
+	switch v := value.(type) {
+	case int64:
+		return tokenValue{Type: "int", Value: strconv.FormatInt(v, 10)}, nil
+	case uint64:
+		return tokenValue{Type: "uint", Value: strconv.FormatUint(v, 10)}, nil
+	case float64:
+		return tokenValue{Type: "float", Value: strconv.FormatFloat(v, 'g', -1, 64)}, nil
+	case bool:
+		return tokenValue{Type: "bool", Value: strconv.FormatBool(v)}, nil
+	case string:
+		return tokenValue{Type: "string", Value: v}, nil
+	case Decimal:
+		return tokenValue{Type: "decimal", Value: string(v)}, nil
+	case []byte:
+		return tokenValue{Type: "bytes", Value: base64.StdEncoding.EncodeToString(v)}, nil
+	case time.Time:
+		return tokenValue{Type: "time", Value: v.Format(time.RFC3339Nano)}, nil
+	case nil:
+		return tokenValue{}, errors.New("value is NULL")
+	}
+	return tokenValue{}, fmt.Errorf("unsupported type %T", value)
+}
+
+func decodeTokenValue(encoded tokenValue) (interface{}, error) {
+	switch encoded.Type {
+	case "int":
+		return strconv.ParseInt(encoded.Value, 10, 64)
+	case "uint":
+		return strconv.ParseUint(encoded.Value, 10, 64)
+	case "float":
+		return strconv.ParseFloat(encoded.Value, 64)
+	case "bool":
+		return strconv.ParseBool(encoded.Value)
+	case "string":
+		return encoded.Value, nil
+	case "decimal":
+		return Decimal(encoded.Value), nil
+	case "bytes":
+		return base64.StdEncoding.DecodeString(encoded.Value)
+	case "time":
+		return time.Parse(time.RFC3339Nano, encoded.Value)
+	}
+	return nil, fmt.Errorf("unknown type %q", encoded.Type)
+}
@@ -0,0 +1,152 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anmollp/generic-db-go/src/filters"
+	"github.com/stretchr/testify/assert"
+)
+
+var paginationKey = []byte("secret")
+
+// userTable makes the fake database serve "SELECT id FROM users" ordered by id in either
+// direction from the given ids, seeking past the id passed as the only parameter.
+func userTable(fdb *fakeDatabase, ids ...int64) {
+	fdb.onQuery = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		descending := strings.Contains(query, "ORDER BY id DESC")
+		var rows [][]driver.Value
+		for _, id := range ids {
+			if len(args) == 1 && (descending && id >= args[0].(int64) || !descending && id <= args[0].(int64)) {
+				continue
+			}
+			rows = append(rows, []driver.Value{id})
+		}
+		sort.Slice(rows, func(i, j int) bool { return rows[i][0].(int64) < rows[j][0].(int64) != descending })
+		return []string{"id"}, rows, nil
+	}
+}
+
+func pageIDs(page Page) []int64 {
+	var ids []int64
+	for _, row := range page.Rows {
+		ids = append(ids, row["id"].(int64))
+	}
+	return ids
+}
+
+func TestPaginatorPagesForwardAndBackward(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	userTable(fdb, 1, 2, 3, 4, 5)
+	paginator, err := NewPaginator(rds, paginationKey, "SELECT id FROM users", nil, []filters.SortColumn{{Column: "id"}}, 2)
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	first, err := paginator.Page(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1, 2}, pageIDs(first))
+	assert.Empty(t, first.Previous)
+
+	second, err := paginator.Page(ctx, first.Next)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{3, 4}, pageIDs(second))
+
+	last, err := paginator.Page(ctx, second.Next)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{5}, pageIDs(last))
+	assert.Empty(t, last.Next)
+
+	back, err := paginator.Page(ctx, last.Previous)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{3, 4}, pageIDs(back))
+	assert.NotEmpty(t, back.Next)
+
+	front, err := paginator.Page(ctx, back.Previous)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1, 2}, pageIDs(front))
+	assert.Empty(t, front.Previous)
+	assert.Equal(t, first.Next, front.Next)
+
+	assert.Equal(t, []string{
+		"SELECT id FROM users ORDER BY id LIMIT 3 []",
+		"SELECT id FROM users WHERE id > ? ORDER BY id LIMIT 3 [2]",
+		"SELECT id FROM users WHERE id > ? ORDER BY id LIMIT 3 [4]",
+		"SELECT id FROM users WHERE id < ? ORDER BY id DESC LIMIT 3 [5]",
+		"SELECT id FROM users WHERE id < ? ORDER BY id DESC LIMIT 3 [3]",
+	}, fdb.Statements())
+}
+
+func TestPaginatorSeeksWithFilterAndMixedOrder(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	fdb.columnTypes = map[string]string{"created_at": "DATETIME"}
+	var lastArgs []driver.Value
+	fdb.onQuery = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		lastArgs = args
+		return []string{"id", "created_at"}, [][]driver.Value{
+			{int64(8), []byte("2024-01-02 03:04:05")},
+			{int64(9), []byte("2024-01-02 03:04:05")},
+		}, nil
+	}
+	paginator, err := NewPaginator(rds, paginationKey, "SELECT u.id, u.created_at FROM users u",
+		filters.Equals{Column: "u.status", Value: "active"},
+		[]filters.SortColumn{{Column: "u.created_at", Descending: true}, {Column: "u.id"}}, 1)
+	assert.NoError(t, err)
+
+	first, err := paginator.Page(context.Background(), "")
+	assert.NoError(t, err)
+	_, err = paginator.Page(context.Background(), first.Next)
+	assert.NoError(t, err)
+
+	statements := fdb.Statements()
+	assert.True(t, strings.HasPrefix(statements[1], "SELECT u.id, u.created_at FROM users u "+
+		"WHERE (u.status = ?) AND (u.created_at < ? OR (u.created_at = ? AND u.id > ?)) "+
+		"ORDER BY u.created_at DESC, u.id LIMIT 2 "), statements[1])
+	assert.Equal(t, []driver.Value{"active", createdAt, createdAt, int64(8)}, lastArgs)
+}
+
+func TestPaginatorRejectsTamperedTokens(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	userTable(fdb, 1, 2, 3)
+	order := []filters.SortColumn{{Column: "id"}}
+	paginator, err := NewPaginator(rds, paginationKey, "SELECT id FROM users", nil, order, 1)
+	assert.NoError(t, err)
+	first, err := paginator.Page(context.Background(), "")
+	assert.NoError(t, err)
+
+	payload, mac, _ := strings.Cut(first.Next, ".")
+	for _, token := range []string{"garbage", payload + ".", strings.ToUpper(payload) + "." + mac} {
+		_, err = paginator.Page(context.Background(), token)
+		assert.ErrorIs(t, err, ErrInvalidPageToken, token)
+	}
+
+	otherKey, _ := NewPaginator(rds, []byte("other"), "SELECT id FROM users", nil, order, 1)
+	_, err = otherKey.Page(context.Background(), first.Next)
+	assert.ErrorIs(t, err, ErrInvalidPageToken)
+
+	otherFilter, _ := NewPaginator(rds, paginationKey, "SELECT id FROM users", filters.Equals{Column: "tenant_id", Value: 2}, order, 1)
+	_, err = otherFilter.Page(context.Background(), first.Next)
+	assert.ErrorIs(t, err, ErrInvalidPageToken)
+}
+
+func TestNewPaginatorValidates(t *testing.T) {
+	pool, _ := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	order := []filters.SortColumn{{Column: "id"}}
+
+	_, err := NewPaginator(rds, nil, "SELECT id FROM users", nil, order, 10)
+	assert.Error(t, err)
+	_, err = NewPaginator(rds, paginationKey, "SELECT id FROM users", nil, nil, 10)
+	assert.Error(t, err)
+	_, err = NewPaginator(rds, paginationKey, "SELECT id FROM users", nil, []filters.SortColumn{{Column: "id; DROP TABLE users"}}, 10)
+	assert.EqualError(t, err, `invalid column name "id; DROP TABLE users"`)
+	_, err = NewPaginator(rds, paginationKey, "SELECT id FROM users", nil, order, 0)
+	assert.EqualError(t, err, "invalid page size 0")
+}
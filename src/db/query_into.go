@@ -0,0 +1,177 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// fieldMap maps the db tag names of a struct type to their field index paths.
+type fieldMap map[string][]int
+
+var fieldMaps sync.Map // reflect.Type -> fieldMap, or error
+
+// QueryInto runs a query like ExecuteQueryContext and scans each row into a T, which
+// must be a struct. Columns are matched to fields by their `db:"column"` tag; fields of
+// embedded structs are matched as if they were T's own, and untagged fields or ones
+// tagged `db:"-"` are left alone. Use pointer fields, or sql.Null* types, for columns
+// that may be NULL. A column without a matching field, or a tagged field without a
+// matching column, is an error.
+func QueryInto[T any](ctx context.Context, r *RDSPooledConnection, sqlQuery string, params []interface{}) ([]T, error) {
+	fields, err := fieldsOf(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return nil, err
+	}
+
+	var results []T
+	err = r.queryRows(ctx, sqlQuery, params, func(rows *sql.Rows) error {
+		columns, err := rows.Columns()
+		if err != nil {
+			return err
+		}
+		if err := fields.check(columns, reflect.TypeOf((*T)(nil)).Elem()); err != nil {
+			return err
+		}
+
+		for rows.Next() {
+			var result T
+			if err := rows.Scan(fields.destinations(reflect.ValueOf(&result).Elem(), columns)...); err != nil {
+				return fmt.Errorf("failed to scan into %T: %w", result, err)
+			}
+			results = append(results, result)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// QueryOne is QueryInto returning only the first row, or sql.ErrNoRows if there is none.
+func QueryOne[T any](ctx context.Context, r *RDSPooledConnection, sqlQuery string, params []interface{}) (T, error) {
+	var zero T
+	results, err := QueryInto[T](ctx, r, sqlQuery, params)
+	if err != nil {
+		return zero, err
+	}
+	if len(results) == 0 {
+		return zero, sql.ErrNoRows
+	}
+	return results[0], nil
+}
+
+// fieldsOf returns the fieldMap of struct type t, building it on first use.
+func fieldsOf(t reflect.Type) (fieldMap, error) {
+	if cached, ok := fieldMaps.Load(t); ok {
+		if err, isErr := cached.(error); isErr {
+			return nil, err
+		}
+		return cached.(fieldMap), nil
+	}
+
+	var fields fieldMap
+	var err error
+	if t.Kind() != reflect.Struct {
+		err = fmt.Errorf("cannot scan rows into %s: not a struct", t)
+	} else {
+		fields = fieldMap{}
+		err = fields.add(t, nil)
+	}
+
+	if err != nil {
+		fieldMaps.Store(t, err)
+		return nil, err
+	}
+	fieldMaps.Store(t, fields)
+	return fields, nil
+}
+
+// add records the tagged fields of t, whose index path within the scanned struct is
+// prefix, recursing into untagged embedded structs.
+func (m fieldMap) add(t reflect.Type, prefix []int) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		index := append(append([]int(nil), prefix...), i)
+		tag, tagged := field.Tag.Lookup("db")
+		if tag == "-" {
+			continue
+		}
+
+		if !tagged {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if field.Anonymous && embedded.Kind() == reflect.Struct {
+				if field.Type.Kind() == reflect.Pointer && !field.IsExported() {
+					return fmt.Errorf("embedded field %s.%s cannot be allocated: pointer to unexported type", t, field.Name)
+				}
+				if err := m.add(embedded, index); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if !field.IsExported() {
+			return fmt.Errorf("field %s.%s has a db tag but is not exported", t, field.Name)
+		}
+		if _, ok := m[tag]; ok {
+			return fmt.Errorf("db tag %q is used by more than one field of %s", tag, t)
+		}
+		m[tag] = index
+	}
+	return nil
+}
+
+// check reports columns without a field and fields without a column.
+func (m fieldMap) check(columns []string, t reflect.Type) error {
+	seen := make(map[string]bool, len(columns))
+	var unmapped []string
+	for _, column := range columns {
+		if _, ok := m[column]; !ok {
+			unmapped = append(unmapped, column)
+		}
+		seen[column] = true
+	}
+	if len(unmapped) > 0 {
+		return fmt.Errorf("columns %s have no matching db tag in %s", strings.Join(unmapped, ", "), t)
+	}
+
+	var missing []string
+	for tag := range m {
+		if !seen[tag] {
+			missing = append(missing, tag)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("fields of %s tagged %s are missing from the query's columns", t, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// destinations returns pointers to the fields of v matching columns, allocating
+// embedded struct pointers on the way.
+func (m fieldMap) destinations(v reflect.Value, columns []string) []interface{} {
+	dest := make([]interface{}, len(columns))
+	for i, column := range columns {
+		field := v
+		for _, index := range m[column] {
+			if field.Kind() == reflect.Pointer {
+				if field.IsNil() {
+					field.Set(reflect.New(field.Type().Elem()))
+				}
+				field = field.Elem()
+			}
+			field = field.Field(index)
+		}
+		dest[i] = field.Addr().Interface()
+	}
+	return dest
+}
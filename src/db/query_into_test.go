@@ -0,0 +1,108 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type audit struct {
+	CreatedBy string `db:"created_by"`
+}
+
+type user struct {
+	audit
+	ID       int64   `db:"id"`
+	Name     string  `db:"name"`
+	Nickname *string `db:"nickname"`
+}
+
+// userRows makes the fake database return rows with the given columns and values.
+func userRows(fdb *fakeDatabase, columns []string, values ...[]driver.Value) {
+	fdb.onQuery = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		return columns, values, nil
+	}
+}
+
+func TestQueryInto(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	userRows(fdb, []string{"id", "name", "nickname", "created_by"},
+		[]driver.Value{int64(1), []byte("Ada"), []byte("ada"), []byte("admin")},
+		[]driver.Value{int64(2), []byte("Grace"), nil, []byte("admin")},
+	)
+
+	users, err := QueryInto[user](context.Background(), rds, "SELECT id, name, nickname, created_by FROM users", nil)
+
+	assert.NoError(t, err)
+	nickname := "ada"
+	assert.Equal(t, []user{
+		{audit: audit{CreatedBy: "admin"}, ID: 1, Name: "Ada", Nickname: &nickname},
+		{audit: audit{CreatedBy: "admin"}, ID: 2, Name: "Grace"},
+	}, users)
+}
+
+type event struct {
+	*Timestamps
+	ID int64 `db:"id"`
+}
+
+type Timestamps struct {
+	CreatedAt time.Time `db:"created_at"`
+}
+
+func TestQueryOneAllocatesEmbeddedPointer(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	userRows(fdb, []string{"id", "created_at"}, []driver.Value{int64(7), createdAt})
+
+	e, err := QueryOne[event](context.Background(), rds, "SELECT id, created_at FROM events WHERE id = ?", []interface{}{7})
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), e.ID)
+	if assert.NotNil(t, e.Timestamps) {
+		assert.Equal(t, createdAt, e.CreatedAt)
+	}
+}
+
+func TestQueryOneNoRows(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	userRows(fdb, []string{"id", "name", "nickname", "created_by"})
+
+	_, err := QueryOne[user](context.Background(), rds, "SELECT id, name, nickname, created_by FROM users", nil)
+
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestQueryIntoColumnErrors(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+
+	userRows(fdb, []string{"id", "name", "nickname", "created_by", "email"})
+	_, err := QueryInto[user](context.Background(), rds, "SELECT * FROM users", nil)
+	assert.EqualError(t, err, "columns email have no matching db tag in db.user")
+
+	userRows(fdb, []string{"id", "name"})
+	_, err = QueryInto[user](context.Background(), rds, "SELECT id, name FROM users", nil)
+	assert.EqualError(t, err, "fields of db.user tagged created_by, nickname are missing from the query's columns")
+
+	userRows(fdb, []string{"id", "name", "nickname", "created_by"}, []driver.Value{int64(1), nil, nil, []byte("admin")})
+	_, err = QueryInto[user](context.Background(), rds, "SELECT id, name, nickname, created_by FROM users", nil)
+	assert.ErrorContains(t, err, `failed to scan into db.user`)
+	assert.ErrorContains(t, err, `name "name"`)
+}
+
+func TestQueryIntoRequiresStruct(t *testing.T) {
+	pool, _ := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+
+	_, err := QueryInto[int](context.Background(), rds, "SELECT 1", nil)
+
+	assert.EqualError(t, err, "cannot scan rows into int: not a struct")
+}
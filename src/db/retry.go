@@ -0,0 +1,121 @@
+package db
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/anmollp/generic-db-go/src/dberrors"
+)
+
+// RetryPolicy controls how a transaction is retried after a deadlock or lock wait timeout.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	MaxAttempts int
+	// BaseDelay is the backoff ceiling before the second attempt; it doubles for every
+	// further attempt up to MaxDelay. The actual wait is jittered below the ceiling.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// OnRetry, if set, is called before waiting with the attempt that failed, its error
+	// and the delay before the next attempt.
+	OnRetry func(attempt int, err error, delay time.Duration)
+}
+
+// DefaultRetryPolicy returns a policy making up to three attempts with 50ms-1s backoff.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   50 * time.Millisecond,
+		MaxDelay:    time.Second,
+	}
+}
+
+// IsRetryable reports whether err is a MySQL deadlock or lock wait timeout.
+func IsRetryable(err error) bool {
+	return dberrors.Retryable(err)
+}
+
+// run calls attempt until it succeeds, fails with an error that is not retryable,
+// or MaxAttempts is reached, and returns the last error. If ctx is done before the
+// next attempt, waiting stops and ctx.Err() is returned.
+func (p RetryPolicy) run(ctx context.Context, attempt func() error) error {
+	var err error
+	for i := 1; ; i++ {
+		err = attempt()
+		if err == nil || !IsRetryable(err) || i >= p.MaxAttempts {
+			return err
+		}
+
+		delay := p.backoff(i)
+		if p.OnRetry != nil {
+			p.OnRetry(i, err, delay)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// backoff returns a random delay below the exponential ceiling for the given failed attempt.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	ceiling := p.BaseDelay
+	for i := 1; i < attempt && ceiling < p.MaxDelay; i++ {
+		ceiling *= 2
+	}
+	if p.MaxDelay > 0 && ceiling > p.MaxDelay {
+		ceiling = p.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return ceiling/2 + time.Duration(rand.Int63n(int64(ceiling/2)+1))
+}
+
+// ExecuteFunctionsWithRetry is ExecuteFunctions that runs the whole function list again,
+// in a fresh transaction, when it fails with a deadlock or lock wait timeout. Inside an
+// already registered transaction it runs once, since only the outermost caller can
+// retry the transaction as a whole.
+func (r *RDSPooledConnection) ExecuteFunctionsWithRetry(policy RetryPolicy, updateFunctions []func() error) error {
+	return r.ExecuteFunctionsWithRetryContext(context.Background(), policy, TxOptions{}, updateFunctions)
+}
+
+// ExecuteFunctionsWithRetryContext is ExecuteFunctionsWithRetry with each attempt run
+// like ExecuteFunctionsWithOptionsContext. Once ctx is done no further attempt is made
+// and ctx.Err() is returned, also while waiting between attempts. A transaction carried
+// by ctx counts as an outer one, so the functions join it and run once.
+func (r *RDSPooledConnection) ExecuteFunctionsWithRetryContext(ctx context.Context, policy RetryPolicy, opts TxOptions, updateFunctions []func() error) error {
+	if _, ok := r.activeTransactionManager(ctx); ok {
+		return r.executeFunctions(ctx, opts, updateFunctions)
+	}
+	return policy.run(ctx, func() error {
+		return r.executeFunctions(ctx, opts, updateFunctions)
+	})
+}
+
+// CreateWithRetry wraps f like Create, running it again in a fresh transaction when it
+// fails with a deadlock or lock wait timeout and no outer transaction was active.
+func (factory *TransactionDecoratorFactory) CreateWithRetry(policy RetryPolicy, f func() error) func() error {
+	decorated := factory.CreateWithRetryContext(policy, TxOptions{}, func(context.Context) error { return f() })
+	return func() error {
+		return decorated(context.Background())
+	}
+}
+
+// CreateWithRetryContext is CreateWithRetry wrapping f like CreateWithOptionsContext
+// with PropagationRequired. Once the context passed to the decorated function is done
+// no further attempt is made and its Err() is returned.
+func (factory *TransactionDecoratorFactory) CreateWithRetryContext(policy RetryPolicy, opts TxOptions, f func(ctx context.Context) error) func(ctx context.Context) error {
+	decorated := factory.CreateWithOptionsContext(PropagationRequired, opts, f)
+	return func(ctx context.Context) error {
+		if _, ok := factory.txManagerPool.activeTransactionManager(ctx); ok {
+			return decorated(ctx)
+		}
+		return policy.run(ctx, func() error {
+			return decorated(ctx)
+		})
+	}
+}
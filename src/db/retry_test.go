@@ -0,0 +1,115 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func failFirstExecs(fdb *fakeDatabase, n int, err error) {
+	fdb.onExec = func(query string, args []driver.Value) (driver.Result, error) {
+		if n > 0 {
+			n--
+			return nil, err
+		}
+		return driver.RowsAffected(1), nil
+	}
+}
+
+func TestExecuteFunctionsWithRetryRerunsAfterDeadlock(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	failFirstExecs(fdb, 1, &mysql.MySQLError{Number: 1213, Message: "Deadlock found"})
+
+	var retries []int
+	policy := RetryPolicy{MaxAttempts: 3, OnRetry: func(attempt int, err error, delay time.Duration) {
+		retries = append(retries, attempt)
+	}}
+	err := rds.ExecuteFunctionsWithRetry(policy, []func() error{execUpdate(rds, "UPDATE t SET n = 1")})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1}, retries)
+	assert.Equal(t, []string{
+		"BEGIN", "UPDATE t SET n = 1 []", "ROLLBACK",
+		"BEGIN", "UPDATE t SET n = 1 []", "COMMIT",
+	}, fdb.Statements())
+}
+
+func TestExecuteFunctionsWithRetryGivesUp(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	lockTimeout := &mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"}
+	failFirstExecs(fdb, 5, lockTimeout)
+
+	err := rds.ExecuteFunctionsWithRetry(RetryPolicy{MaxAttempts: 2}, []func() error{execUpdate(rds, "UPDATE t SET n = 1")})
+
+	assert.ErrorIs(t, err, lockTimeout)
+	assert.Len(t, fdb.Statements(), 6)
+}
+
+func TestCreateWithRetryDoesNotRetryOtherErrors(t *testing.T) {
+	factory, rds, fdb := newFakeFactory(t)
+	duplicate := &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}
+	failFirstExecs(fdb, 1, duplicate)
+
+	err := factory.CreateWithRetry(DefaultRetryPolicy(), execUpdate(rds, "INSERT INTO t VALUES (1)"))()
+
+	assert.ErrorIs(t, err, duplicate)
+	assert.Equal(t, []string{"BEGIN", "INSERT INTO t VALUES (1) []", "ROLLBACK"}, fdb.Statements())
+}
+
+func TestCreateWithRetryInsideTransactionRunsOnce(t *testing.T) {
+	factory, rds, fdb := newFakeFactory(t)
+	failFirstExecs(fdb, 1, &mysql.MySQLError{Number: 1213, Message: "Deadlock found"})
+
+	retried := factory.CreateWithRetry(DefaultRetryPolicy(), execUpdate(rds, "UPDATE t SET n = 1"))
+	err := factory.Create(retried)()
+
+	assert.True(t, IsRetryable(err))
+	assert.Equal(t, []string{"BEGIN", "UPDATE t SET n = 1 []", "ROLLBACK"}, fdb.Statements())
+}
+
+func TestExecuteFunctionsWithRetryContextStopsWaitingWhenDone(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	failFirstExecs(fdb, 5, &mysql.MySQLError{Number: 1213, Message: "Deadlock found"})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour, MaxDelay: time.Hour}
+	err := rds.ExecuteFunctionsWithRetryContext(ctx, policy, TxOptions{}, []func() error{execUpdate(rds, "UPDATE t SET n = 1")})
+
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, []string{"BEGIN", "UPDATE t SET n = 1 []", "ROLLBACK"}, fdb.Statements())
+}
+
+func TestCreateWithRetryContextRerunsAfterDeadlock(t *testing.T) {
+	factory, rds, fdb := newFakeFactory(t)
+	failFirstExecs(fdb, 1, &mysql.MySQLError{Number: 1213, Message: "Deadlock found"})
+
+	decorated := factory.CreateWithRetryContext(RetryPolicy{MaxAttempts: 2}, TxOptions{ReadOnly: true}, func(ctx context.Context) error {
+		_, _, err := rds.ExecuteUpdatesContext(ctx, []SQLUpdate{{SQL: "UPDATE t SET n = 1"}})
+		return err
+	})
+
+	assert.NoError(t, decorated(context.Background()))
+	assert.Equal(t, []string{
+		"BEGIN READ ONLY", "UPDATE t SET n = 1 []", "ROLLBACK",
+		"BEGIN READ ONLY", "UPDATE t SET n = 1 []", "COMMIT",
+	}, fdb.Statements())
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: 300 * time.Millisecond}
+	for attempt, ceiling := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 5: 300 * time.Millisecond} {
+		delay := policy.backoff(attempt)
+		assert.GreaterOrEqual(t, delay, ceiling/2)
+		assert.LessOrEqual(t, delay, ceiling)
+	}
+}
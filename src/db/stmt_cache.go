@@ -0,0 +1,233 @@
+package db
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// MySQL error numbers meaning a server-side prepared statement must be prepared again.
+const (
+	errUnknownStmtHandler = 1243
+	errNeedReprepare      = 1615
+)
+
+// StatementCacheStats reports how a statement cache has been used.
+type StatementCacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Size      int // Statements currently cached.
+}
+
+// stmtCache is an LRU cache of statements prepared on a connection pool, keyed by SQL.
+// A statement evicted while in use is closed once its last user releases it.
+type stmtCache struct {
+	pool     *sql.DB
+	capacity int
+	entries  map[string]*cachedStmt
+	lru      *list.List // Of *cachedStmt, most recently used first.
+	stats    StatementCacheStats
+	mu       sync.Mutex
+}
+
+type cachedStmt struct {
+	sql     string
+	stmt    *sql.Stmt
+	refs    int
+	evicted bool
+	elem    *list.Element
+}
+
+func newStmtCache(pool *sql.DB, capacity int) *stmtCache {
+	return &stmtCache{
+		pool:     pool,
+		capacity: capacity,
+		entries:  map[string]*cachedStmt{},
+		lru:      list.New(),
+	}
+}
+
+// get returns the statement for query, preparing it on a miss. The caller must pass it
+// to put once done with it.
+func (c *stmtCache) get(ctx context.Context, query string) (*cachedStmt, error) {
+	c.mu.Lock()
+	if entry, ok := c.entries[query]; ok {
+		entry.refs++
+		c.lru.MoveToFront(entry.elem)
+		c.stats.Hits++
+		c.mu.Unlock()
+		return entry, nil
+	}
+	c.stats.Misses++
+	c.mu.Unlock()
+
+	stmt, err := c.pool.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.entries[query]; ok {
+		// Prepared concurrently by another caller; keep theirs.
+		stmt.Close()
+		entry.refs++
+		c.lru.MoveToFront(entry.elem)
+		return entry, nil
+	}
+	entry := &cachedStmt{sql: query, stmt: stmt, refs: 1}
+	entry.elem = c.lru.PushFront(entry)
+	c.entries[query] = entry
+	for c.lru.Len() > c.capacity {
+		c.evict(c.lru.Back().Value.(*cachedStmt))
+	}
+	return entry, nil
+}
+
+// put hands back a statement returned by get, evicting it if err shows it went stale.
+func (c *stmtCache) put(entry *cachedStmt, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry.refs--
+	if err != nil && staleStatement(err) && !entry.evicted {
+		c.evict(entry)
+		return
+	}
+	if entry.evicted && entry.refs == 0 {
+		closeCachedStmt(entry)
+	}
+}
+
+// evict removes entry from the cache, closing it unless it is in use.
+func (c *stmtCache) evict(entry *cachedStmt) {
+	c.lru.Remove(entry.elem)
+	delete(c.entries, entry.sql)
+	entry.evicted = true
+	c.stats.Evictions++
+	if entry.refs == 0 {
+		closeCachedStmt(entry)
+	}
+}
+
+// clear evicts every statement.
+func (c *stmtCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for c.lru.Len() > 0 {
+		c.evict(c.lru.Back().Value.(*cachedStmt))
+	}
+}
+
+func (c *stmtCache) snapshot() StatementCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Size = c.lru.Len()
+	return stats
+}
+
+func closeCachedStmt(entry *cachedStmt) {
+	if err := entry.stmt.Close(); err != nil {
+		log.Printf("Error closing cached statement: %v", err)
+	}
+}
+
+// staleStatement reports whether err means a cached statement may no longer be usable:
+// its connection broke, or the server lost or invalidated the prepared statement. SQL
+// errors, caller mistakes such as a wrong argument count and the caller's context
+// ending leave the statement cached.
+func staleStatement(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) {
+		return true
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == errNeedReprepare || mysqlErr.Number == errUnknownStmtHandler
+	}
+	return false
+}
+
+type bypassStmtCacheContextKey struct{}
+
+// WithoutStatementCache returns a copy of ctx whose statements are prepared afresh and
+// closed after use instead of going through the statement cache. Use it for one-off
+// dynamic SQL, such as queries built with a long filters.In list, that would only push
+// reusable statements out of the cache.
+func WithoutStatementCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassStmtCacheContextKey{}, true)
+}
+
+// SetStatementCacheSize sets how many prepared statements are kept for reuse, least
+// recently used first out. Zero, the default, disables the cache; statements are then
+// prepared on every call and closed afterwards. Call it before the connection is
+// shared between goroutines.
+//
+// Outside a transaction only calls running one statement once use the cache: queries,
+// and ExecuteUpdates with a single update of at most one row. Such a statement runs on
+// whichever pooled connection is free, so session state set by an earlier call, such
+// as user variables or LAST_INSERT_ID(), is not visible to it. Calls running several
+// statements keep them on one pinned connection and bypass the cache.
+func (r *RDSPooledConnection) SetStatementCacheSize(size int) {
+	if r.stmtCache != nil {
+		r.stmtCache.clear()
+		r.stmtCache = nil
+	}
+	if size > 0 {
+		r.stmtCache = newStmtCache(r.cnxPool, size)
+	}
+}
+
+// StatementCacheStats returns the statement cache's counters; all zero when it is disabled.
+func (r *RDSPooledConnection) StatementCacheStats() StatementCacheStats {
+	if r.stmtCache == nil {
+		return StatementCacheStats{}
+	}
+	return r.stmtCache.snapshot()
+}
+
+// useStmtCache reports whether statements run with ctx go through the statement cache.
+func (r *RDSPooledConnection) useStmtCache(ctx context.Context) bool {
+	bypass, _ := ctx.Value(bypassStmtCacheContextKey{}).(bool)
+	return r.stmtCache != nil && !bypass
+}
+
+// prepare returns a statement for query on cnx, from the statement cache when cnx is
+// the pool or a transaction and the cache is in use. done must be called with the
+// error the statement ended with, if any, once it is no longer used.
+func (r *RDSPooledConnection) prepare(ctx context.Context, cnx preparer, query string) (stmt *sql.Stmt, done func(err error), err error) {
+	switch c := cnx.(type) {
+	case *sql.DB, *sql.Tx:
+		if !r.useStmtCache(ctx) {
+			break
+		}
+		entry, err := r.stmtCache.get(ctx, query)
+		if err != nil {
+			return nil, nil, err
+		}
+		if tx, ok := c.(*sql.Tx); ok {
+			txStmt := tx.StmtContext(ctx, entry.stmt)
+			return txStmt, func(err error) {
+				txStmt.Close()
+				r.stmtCache.put(entry, err)
+			}, nil
+		}
+		return entry.stmt, func(err error) { r.stmtCache.put(entry, err) }, nil
+	}
+
+	stmt, err = cnx.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	return stmt, func(error) { stmt.Close() }, nil
+}
@@ -0,0 +1,150 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func newCachedRDS(t *testing.T, size int) (*RDSPooledConnection, *fakeDatabase) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	rds.SetStatementCacheSize(size)
+	t.Cleanup(func() { rds.SetStatementCacheSize(0) })
+	return rds, fdb
+}
+
+func TestStatementCacheReusesStatements(t *testing.T) {
+	rds, fdb := newCachedRDS(t, 10)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, execUpdate(rds, "UPDATE t SET n = n + 1")())
+	}
+	_, err := rds.ExecuteQuery("SELECT n FROM t", nil, false)
+	assert.NoError(t, err)
+
+	assert.Equal(t, StatementCacheStats{Hits: 2, Misses: 2, Size: 2}, rds.StatementCacheStats())
+	assert.Len(t, fdb.Statements(), 4)
+}
+
+func TestStatementCacheInsideTransaction(t *testing.T) {
+	rds, fdb := newCachedRDS(t, 10)
+	assert.NoError(t, execUpdate(rds, "UPDATE t SET n = n + 1")())
+
+	err := rds.ExecuteFunctions([]func() error{
+		execUpdate(rds, "UPDATE t SET n = n + 1"),
+		execUpdate(rds, "UPDATE t SET n = n + 1"),
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, StatementCacheStats{Hits: 2, Misses: 1, Size: 1}, rds.StatementCacheStats())
+	assert.Equal(t, []string{
+		"UPDATE t SET n = n + 1 []",
+		"BEGIN",
+		"UPDATE t SET n = n + 1 []",
+		"UPDATE t SET n = n + 1 []",
+		"COMMIT",
+	}, fdb.Statements())
+}
+
+func TestStatementCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	rds, _ := newCachedRDS(t, 2)
+
+	for _, query := range []string{"UPDATE a SET n = 1", "UPDATE b SET n = 1", "UPDATE a SET n = 1", "UPDATE c SET n = 1", "UPDATE a SET n = 1"} {
+		assert.NoError(t, execUpdate(rds, query)())
+	}
+
+	assert.Equal(t, StatementCacheStats{Hits: 2, Misses: 3, Evictions: 1, Size: 2}, rds.StatementCacheStats())
+}
+
+func TestStatementCacheInvalidatesOnDriverErrors(t *testing.T) {
+	rds, fdb := newCachedRDS(t, 10)
+	fdb.onExec = func(query string, args []driver.Value) (driver.Result, error) {
+		switch query {
+		case "INSERT INTO t VALUES (1)":
+			return nil, &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}
+		case "INSERT INTO t VALUES (?)":
+			return nil, errors.New("unsupported type")
+		case "UPDATE t SET n = 2":
+			return nil, &mysql.MySQLError{Number: 1615, Message: "Prepared statement needs to be re-prepared"}
+		}
+		return nil, mysql.ErrInvalidConn
+	}
+
+	assert.Error(t, execUpdate(rds, "INSERT INTO t VALUES (1)")())
+	assert.Equal(t, 1, rds.StatementCacheStats().Size, "SQL errors leave the statement cached")
+	_, _, err := rds.ExecuteUpdates([]SQLUpdate{{SQL: "INSERT INTO t VALUES (?)", Values: [][]interface{}{{1}}}})
+	assert.Error(t, err)
+	assert.Equal(t, 2, rds.StatementCacheStats().Size, "caller mistakes leave the statement cached")
+
+	assert.Error(t, execUpdate(rds, "UPDATE t SET n = 1")())
+	assert.Error(t, execUpdate(rds, "UPDATE t SET n = 2")())
+	assert.Equal(t, StatementCacheStats{Misses: 4, Evictions: 2, Size: 2}, rds.StatementCacheStats())
+}
+
+func TestStatementCachePinsMultiStatementCalls(t *testing.T) {
+	rds, fdb := newCachedRDS(t, 10)
+	// Leave several idle connections in the pool for the statements to drift between.
+	first, err := rds.cnxPool.Conn(context.Background())
+	assert.NoError(t, err)
+	second, err := rds.cnxPool.Conn(context.Background())
+	assert.NoError(t, err)
+	first.Close()
+	second.Close()
+
+	_, _, err = rds.ExecuteUpdates([]SQLUpdate{
+		{SQL: "SET @x = 1"},
+		{SQL: "INSERT INTO t VALUES (@x)"},
+		{SQL: "INSERT INTO t VALUES (?)", Values: [][]interface{}{{1}, {2}}},
+	})
+
+	assert.NoError(t, err)
+	events := fdb.Events()
+	if assert.Len(t, events, 4) {
+		for _, event := range events[1:] {
+			assert.Equal(t, strings.Fields(events[0])[0], strings.Fields(event)[0], "statements of one call must share a connection")
+		}
+	}
+	assert.Equal(t, StatementCacheStats{}, rds.StatementCacheStats())
+}
+
+func TestWithoutStatementCache(t *testing.T) {
+	rds, fdb := newCachedRDS(t, 10)
+
+	_, _, err := rds.ExecuteUpdatesContext(WithoutStatementCache(context.Background()),
+		[]SQLUpdate{{SQL: "DELETE FROM t WHERE id IN (?, ?, ?)", Values: [][]interface{}{{1, 2, 3}}}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, StatementCacheStats{}, rds.StatementCacheStats())
+	assert.Equal(t, []string{"DELETE FROM t WHERE id IN (?, ?, ?) [1 2 3]"}, fdb.Statements())
+}
+
+func TestStatementCacheConcurrentEviction(t *testing.T) {
+	rds, _ := newCachedRDS(t, 2)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if err := execUpdate(rds, fmt.Sprintf("UPDATE t%d SET n = 1", (i+j)%4))(); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	stats := rds.StatementCacheStats()
+	assert.Equal(t, uint64(160), stats.Hits+stats.Misses)
+	assert.LessOrEqual(t, stats.Size, 2)
+}
@@ -0,0 +1,121 @@
+package db
+
+import (
+	"fmt"
+	"log"
+)
+
+// txCallbacks holds the callbacks registered on a TransactionManager. Each callback
+// remembers the savepoint level it was registered at, so rolling back to a savepoint
+// discards only the callbacks registered inside it.
+type txCallbacks struct {
+	onCommit   []commitCallback
+	onRollback []rollbackCallback
+}
+
+type commitCallback struct {
+	level int
+	fn    func()
+}
+
+type rollbackCallback struct {
+	level int
+	fn    func(err error)
+}
+
+// OnCommit registers fn to run once the transaction has committed. It does not run if
+// the transaction, or the savepoint level it was registered in, is rolled back.
+func (tm *TransactionManager) OnCommit(fn func()) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	tm.callbacks.onCommit = append(tm.callbacks.onCommit, commitCallback{level: len(tm.savepoints), fn: fn})
+}
+
+// OnRollback registers fn to run once the transaction, or the savepoint level it was
+// registered in, has been rolled back. err is the error that failed the unit of work,
+// or nil when Release(false) or Rollback was called directly.
+func (tm *TransactionManager) OnRollback(fn func(err error)) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	tm.callbacks.onRollback = append(tm.callbacks.onRollback, rollbackCallback{level: len(tm.savepoints), fn: fn})
+}
+
+// takeCallbacks removes and returns every registered callback.
+func (tm *TransactionManager) takeCallbacks() txCallbacks {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	callbacks := tm.callbacks
+	tm.callbacks = txCallbacks{}
+	return callbacks
+}
+
+// splitAbove removes and returns the callbacks registered deeper than level.
+func (c *txCallbacks) splitAbove(level int) txCallbacks {
+	var above txCallbacks
+	onCommit := c.onCommit[:0]
+	for _, callback := range c.onCommit {
+		if callback.level > level {
+			above.onCommit = append(above.onCommit, callback)
+		} else {
+			onCommit = append(onCommit, callback)
+		}
+	}
+	c.onCommit = onCommit
+
+	onRollback := c.onRollback[:0]
+	for _, callback := range c.onRollback {
+		if callback.level > level {
+			above.onRollback = append(above.onRollback, callback)
+		} else {
+			onRollback = append(onRollback, callback)
+		}
+	}
+	c.onRollback = onRollback
+	return above
+}
+
+// promote moves the callbacks registered deeper than level to level.
+func (c *txCallbacks) promote(level int) {
+	for i := range c.onCommit {
+		c.onCommit[i].level = min(c.onCommit[i].level, level)
+	}
+	for i := range c.onRollback {
+		c.onRollback[i].level = min(c.onRollback[i].level, level)
+	}
+}
+
+// committed runs the OnCommit callbacks in registration order.
+func (c txCallbacks) committed() {
+	for _, callback := range c.onCommit {
+		runCallback(func() { callback.fn() })
+	}
+}
+
+// rolledBack runs the OnRollback callbacks in registration order.
+func (c txCallbacks) rolledBack(err error) {
+	for _, callback := range c.onRollback {
+		runCallback(func() { callback.fn(err) })
+	}
+}
+
+// panicCause turns a recovered panic value into the error passed to OnRollback callbacks.
+func panicCause(rec interface{}) error {
+	if err, ok := rec.(error); ok {
+		return fmt.Errorf("panic: %w", err)
+	}
+	return fmt.Errorf("panic: %v", rec)
+}
+
+// runCallback runs fn, logging instead of propagating a panic so the remaining
+// callbacks still run and the transaction outcome is still reported to the caller.
+func runCallback(fn func()) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.Printf("Transaction callback panicked: %v", rec)
+		}
+	}()
+	fn()
+}
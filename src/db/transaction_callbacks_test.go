@@ -0,0 +1,81 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnCommitRunsAfterOutermostCommit(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	tmr := NewTransactionManagerRegistry(pool)
+	rds := NewRDSPooledConnection(pool, tmr)
+
+	var events []string
+	err := rds.ExecuteFunctions([]func() error{
+		execUpdate(rds, "INSERT INTO t VALUES (1)"),
+		func() error {
+			return rds.ExecuteFunctions([]func() error{func() error {
+				txManager := tmr.GetTransactionManager()
+				txManager.OnCommit(func() { events = append(events, "commit: "+fdb.Statements()[len(fdb.Statements())-1]) })
+				txManager.OnCommit(func() { panic("broken callback") })
+				txManager.OnCommit(func() { events = append(events, "second") })
+				txManager.OnRollback(func(err error) { events = append(events, "rollback") })
+				return nil
+			}})
+		},
+		func() error {
+			assert.Empty(t, events)
+			return nil
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"commit: COMMIT", "second"}, events)
+}
+
+func TestOnRollbackReceivesCause(t *testing.T) {
+	pool, _ := newFakePool(t)
+	tmr := NewTransactionManagerRegistry(pool)
+	rds := NewRDSPooledConnection(pool, tmr)
+
+	var causes []error
+	committed := false
+	err := rds.ExecuteFunctions([]func() error{func() error {
+		tmr.GetTransactionManager().OnCommit(func() { committed = true })
+		tmr.GetTransactionManager().OnRollback(func(err error) { causes = append(causes, err) })
+		return assert.AnError
+	}})
+
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.False(t, committed)
+	assert.Equal(t, []error{assert.AnError}, causes)
+}
+
+func TestSavepointRollbackDiscardsInnerCallbacks(t *testing.T) {
+	pool, _ := newFakePool(t)
+	tmr := NewTransactionManagerRegistry(pool)
+	tmr.SetNestedTransactions(true)
+	rds := NewRDSPooledConnection(pool, tmr)
+
+	var events []string
+	err := rds.ExecuteFunctions([]func() error{func() error {
+		tmr.GetTransactionManager().OnCommit(func() { events = append(events, "outer commit") })
+
+		innerErr := rds.ExecuteFunctions([]func() error{func() error {
+			tmr.GetTransactionManager().OnCommit(func() { events = append(events, "inner commit") })
+			tmr.GetTransactionManager().OnRollback(func(err error) { events = append(events, "inner rollback") })
+			return assert.AnError
+		}})
+		assert.ErrorIs(t, innerErr, assert.AnError)
+		assert.Equal(t, []string{"inner rollback"}, events)
+
+		return rds.ExecuteFunctions([]func() error{func() error {
+			tmr.GetTransactionManager().OnCommit(func() { events = append(events, "released savepoint commit") })
+			return nil
+		}})
+	}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"inner rollback", "outer commit", "released savepoint commit"}, events)
+}
@@ -0,0 +1,171 @@
+package db
+
+import (
+	"context"
+	"log"
+
+	"github.com/anmollp/generic-db-go/src/utils"
+)
+
+type txContextKey struct{}
+
+type bypassTxContextKey struct{}
+
+// contextWithTransaction returns a copy of ctx carrying txManager, undoing WithoutTransaction.
+func contextWithTransaction(ctx context.Context, txManager *TransactionManager) context.Context {
+	if bypass, _ := ctx.Value(bypassTxContextKey{}).(bool); bypass {
+		ctx = context.WithValue(ctx, bypassTxContextKey{}, false)
+	}
+	return context.WithValue(ctx, txContextKey{}, txManager)
+}
+
+// TransactionFromContext returns the TransactionManager carried by ctx, if any.
+func TransactionFromContext(ctx context.Context) (*TransactionManager, bool) {
+	txManager, ok := ctx.Value(txContextKey{}).(*TransactionManager)
+	return txManager, ok
+}
+
+// WithoutTransaction returns a copy of ctx whose statements bypass any active
+// transaction and run, autocommitted, on a fresh pooled connection. Use it for reads
+// that must not see the transaction's uncommitted writes or hold its connection.
+func WithoutTransaction(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassTxContextKey{}, true)
+}
+
+// activeTransactionManager returns the TransactionManager that statements run with ctx
+// should use: the one carried by ctx, falling back to the one registered for the
+// current goroutine so code using TransactionManagerRegistry keeps working. It reports
+// none for a context made by WithoutTransaction.
+func (r *RDSPooledConnection) activeTransactionManager(ctx context.Context) (*TransactionManager, bool) {
+	return r.txManagerPool.activeTransactionManager(ctx)
+}
+
+// activeTransactionManager is RDSPooledConnection.activeTransactionManager.
+func (r *TransactionManagerRegistry) activeTransactionManager(ctx context.Context) (*TransactionManager, bool) {
+	if bypass, _ := ctx.Value(bypassTxContextKey{}).(bool); bypass {
+		return nil, false
+	}
+	if txManager, ok := TransactionFromContext(ctx); ok {
+		return txManager, true
+	}
+	return r.currentTransactionManager()
+}
+
+// contextTransaction returns the transaction active for ctx when it is carried by ctx
+// rather than registered for the current goroutine, e.g. one started by WithTransaction.
+func (r *TransactionManagerRegistry) contextTransaction(ctx context.Context) (*TransactionManager, bool) {
+	txManager, ok := r.activeTransactionManager(ctx)
+	if !ok {
+		return nil, false
+	}
+	registered, _ := r.currentTransactionManager()
+	return txManager, txManager != registered
+}
+
+// joinContextTransaction runs fn in txManager, a transaction returned by
+// contextTransaction. While fn runs txManager is also registered for the current
+// goroutine, so statements run without a context join it too. With savepoint set fn
+// runs in a savepoint that its error or panic rolls back; otherwise they mark the
+// transaction rollback-only, as for a joined WithTransaction.
+func (r *TransactionManagerRegistry) joinContextTransaction(ctx context.Context, txManager *TransactionManager, opts TxOptions, savepoint bool, fn func(ctx context.Context) error) error {
+	if err := txManager.checkJoin(opts); err != nil {
+		return err
+	}
+
+	goroutineID := utils.GetGoroutineID()
+	suspended := r.suspend()
+	r.txManagers.Store(goroutineID, txManager)
+	r.txTrackers.Store(goroutineID, 1)
+	defer func() {
+		r.txManagers.Delete(goroutineID)
+		r.txTrackers.Delete(goroutineID)
+		r.resume(suspended)
+	}()
+
+	if savepoint {
+		return runInSavepoint(ctx, goroutineID, txManager, fn)
+	}
+	return joinTransaction(ctx, txManager, fn)
+}
+
+// runInSavepoint runs fn in a savepoint of txManager opened by owner, rolling back to
+// it if fn fails or panics or ctx is done, and releasing it otherwise.
+func runInSavepoint(ctx context.Context, owner int, txManager *TransactionManager, fn func(ctx context.Context) error) error {
+	txManager.pushSavepoint(owner, 0)
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			if err := txManager.rollbackToSavepoint(owner, panicCause(rec)); err != nil {
+				log.Printf("Failed to roll back savepoint: %v", err)
+			}
+			panic(rec)
+		}
+	}()
+
+	err := fn(ctx)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		err = ctxErr
+	}
+	if err != nil {
+		if rollbackErr := txManager.rollbackToSavepoint(owner, err); rollbackErr != nil {
+			log.Printf("Failed to roll back savepoint: %v", rollbackErr)
+		}
+		return err
+	}
+	return txManager.releaseSavepoint(owner)
+}
+
+// WithTransaction runs fn in a transaction carried by the context passed to it, so
+// ExecuteQueryContext and ExecuteUpdatesContext called with that context, from any
+// goroutine, run in the transaction. The transaction commits if fn returns nil and
+// rolls back if fn returns an error or panics. Once ctx is done the running statement
+// is cancelled, the transaction rolled back and ctx.Err() returned.
+//
+// If a transaction is already active, fn joins it instead; an error or panic from
+// fn then marks the outer transaction rollback-only and the outermost caller
+// decides when it ends.
+func (r *RDSPooledConnection) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if txManager, ok := r.activeTransactionManager(ctx); ok {
+		return joinTransaction(contextWithTransaction(ctx, txManager), txManager, fn)
+	}
+
+	txManager := NewTransactionManager(r.cnxPool)
+	txManager.bindContext(ctx)
+	txCtx := contextWithTransaction(ctx, txManager)
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			if err := txManager.rollback(panicCause(rec)); err != nil {
+				log.Printf("Failed to rollback transaction: %v", err)
+			}
+			panic(rec)
+		}
+	}()
+
+	err := fn(txCtx)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		err = ctxErr
+	}
+	if err != nil {
+		if rollbackErr := txManager.rollback(err); rollbackErr != nil {
+			log.Printf("Failed to rollback transaction: %v", rollbackErr)
+		}
+		return err
+	}
+	return txManager.Commit()
+}
+
+func joinTransaction(ctx context.Context, txManager *TransactionManager, fn func(ctx context.Context) error) error {
+	defer func() {
+		if rec := recover(); rec != nil {
+			txManager.SetRollbackOnly()
+			panic(rec)
+		}
+	}()
+
+	if err := fn(ctx); err != nil {
+		txManager.SetRollbackOnly()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,419 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithTransactionCommitsAcrossGoroutines(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+
+	err := rds.WithTransaction(context.Background(), func(ctx context.Context) error {
+		if _, _, err := rds.ExecuteUpdatesContext(ctx, []SQLUpdate{{SQL: "INSERT INTO t VALUES (1)"}}); err != nil {
+			return err
+		}
+
+		var wg sync.WaitGroup
+		var childErr error
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, childErr = rds.ExecuteUpdatesContext(ctx, []SQLUpdate{{SQL: "INSERT INTO t VALUES (2)"}})
+		}()
+		wg.Wait()
+		return childErr
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"c1 BEGIN",
+		"c1 INSERT INTO t VALUES (1) []",
+		"c1 INSERT INTO t VALUES (2) []",
+		"c1 COMMIT",
+	}, fdb.Events())
+}
+
+func TestWithTransactionRollsBackOnError(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+
+	err := rds.WithTransaction(context.Background(), func(ctx context.Context) error {
+		if _, _, err := rds.ExecuteUpdatesContext(ctx, []SQLUpdate{{SQL: "DELETE FROM t"}}); err != nil {
+			return err
+		}
+		return assert.AnError
+	})
+
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, []string{"BEGIN", "DELETE FROM t []", "ROLLBACK"}, fdb.Statements())
+}
+
+func TestWithTransactionNestedFailureMarksRollbackOnly(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+
+	err := rds.WithTransaction(context.Background(), func(ctx context.Context) error {
+		if _, _, err := rds.ExecuteUpdatesContext(ctx, []SQLUpdate{{SQL: "DELETE FROM t"}}); err != nil {
+			return err
+		}
+		// The outer unit of work swallows the inner failure.
+		_ = rds.WithTransaction(ctx, func(ctx context.Context) error {
+			return assert.AnError
+		})
+		return nil
+	})
+
+	assert.ErrorIs(t, err, ErrRollbackOnly)
+	assert.Equal(t, []string{"BEGIN", "DELETE FROM t []", "ROLLBACK"}, fdb.Statements())
+}
+
+func TestWithTransactionJoinsRegisteredTransaction(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	tmr := NewTransactionManagerRegistry(pool)
+	rds := NewRDSPooledConnection(pool, tmr)
+
+	tmr.Register()
+	err := rds.WithTransaction(context.Background(), func(ctx context.Context) error {
+		txManager, ok := TransactionFromContext(ctx)
+		assert.True(t, ok)
+		assert.Same(t, tmr.GetTransactionManager(), txManager)
+		_, _, err := rds.ExecuteUpdatesContext(ctx, []SQLUpdate{{SQL: "DELETE FROM t"}})
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"BEGIN", "DELETE FROM t []"}, fdb.Statements())
+
+	assert.NoError(t, tmr.Release(true))
+	assert.Equal(t, []string{"BEGIN", "DELETE FROM t []", "COMMIT"}, fdb.Statements())
+}
+
+func TestExecuteQueryReadsThroughActiveTransaction(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	tmr := NewTransactionManagerRegistry(pool)
+	rds := NewRDSPooledConnection(pool, tmr)
+	fdb.onQuery = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		return []string{"n"}, [][]driver.Value{{int64(1)}}, nil
+	}
+
+	err := rds.ExecuteFunctions([]func() error{
+		execUpdate(rds, "UPDATE t SET n = 1"),
+		func() error {
+			row, err := rds.ExecuteQuery("SELECT n FROM t", nil, true)
+			assert.Equal(t, map[string]interface{}{"n": int64(1)}, row)
+			return err
+		},
+		func() error {
+			_, err := rds.ExecuteQueryContext(WithoutTransaction(context.Background()), "SELECT n FROM t", nil, true)
+			return err
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"c1 BEGIN",
+		"c1 UPDATE t SET n = 1 []",
+		"c1 SELECT n FROM t []",
+		"c2 SELECT n FROM t []",
+		"c1 COMMIT",
+	}, fdb.Events())
+}
+
+func TestWithoutTransactionBypassesContextTransaction(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+
+	err := rds.WithTransaction(context.Background(), func(ctx context.Context) error {
+		if _, err := rds.ExecuteQueryContext(ctx, "SELECT 1", nil, false); err != nil {
+			return err
+		}
+		_, err := rds.ExecuteQueryContext(WithoutTransaction(ctx), "SELECT 2", nil, false)
+		return err
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c1 BEGIN", "c1 SELECT 1 []", "c2 SELECT 2 []", "c1 COMMIT"}, fdb.Events())
+}
+
+func TestExecuteFunctionsContextDeadlineCancelsStatement(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	fdb.delay = time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := rds.ExecuteFunctionsContext(ctx, []func() error{
+		execUpdate(rds, "UPDATE t SET n = 1"),
+		execUpdate(rds, "UPDATE t SET n = 2"),
+	})
+
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, []string{"BEGIN", "UPDATE t SET n = 1 []", "ROLLBACK"}, fdb.Statements())
+	assert.Equal(t, 0, pool.Stats().InUse)
+}
+
+func TestExecuteFunctionsContextAlreadyDone(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	ran := false
+	err := rds.ExecuteFunctionsContext(ctx, []func() error{func() error { ran = true; return nil }})
+
+	assert.Equal(t, context.Canceled, err)
+	assert.False(t, ran)
+	assert.Empty(t, fdb.Statements())
+}
+
+func TestReleaseContextRollsBackWhenDone(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	tmr := NewTransactionManagerRegistry(pool)
+	rds := NewRDSPooledConnection(pool, tmr)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	assert.NoError(t, tmr.RegisterContext(ctx, TxOptions{}))
+	assert.NoError(t, execUpdate(rds, "UPDATE t SET n = 1")())
+	cancel()
+	err := tmr.ReleaseContext(ctx, true)
+
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, []string{"BEGIN", "UPDATE t SET n = 1 []", "ROLLBACK"}, fdb.Statements())
+	assert.False(t, tmr.IsRegistered())
+}
+
+func TestWithTransactionReturnsContextError(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	ctx, cancel := context.WithCancel(context.Background())
+
+	err := rds.WithTransaction(ctx, func(ctx context.Context) error {
+		if _, _, err := rds.ExecuteUpdatesContext(ctx, []SQLUpdate{{SQL: "UPDATE t SET n = 1"}}); err != nil {
+			return err
+		}
+		cancel()
+		return nil
+	})
+
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, []string{"BEGIN", "UPDATE t SET n = 1 []", "ROLLBACK"}, fdb.Statements())
+}
+
+func TestExecuteFunctionsWithOptionsContextDeadline(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	fdb.delay = time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err := rds.ExecuteFunctionsWithOptionsContext(ctx, TxOptions{Isolation: sql.LevelSerializable},
+		[]func() error{execUpdate(rds, "UPDATE t SET n = 1")})
+
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, []string{"BEGIN Serializable", "UPDATE t SET n = 1 []", "ROLLBACK"}, fdb.Statements())
+}
+
+func TestCreateWithOptionsContextRollsBackWhenDone(t *testing.T) {
+	factory, rds, fdb := newFakeFactory(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	decorated := factory.CreateWithOptionsContext(PropagationRequired, TxOptions{}, func(ctx context.Context) error {
+		if _, _, err := rds.ExecuteUpdatesContext(ctx, []SQLUpdate{{SQL: "UPDATE t SET n = 1"}}); err != nil {
+			return err
+		}
+		cancel()
+		return nil
+	})
+	err := decorated(ctx)
+
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, []string{"BEGIN", "UPDATE t SET n = 1 []", "ROLLBACK"}, fdb.Statements())
+	assert.False(t, factory.txManagerPool.IsRegistered())
+}
+
+// execUpdateContext returns a decorated function body running sql with its context.
+func execUpdateContext(rds *RDSPooledConnection, sql string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		_, _, err := rds.ExecuteUpdatesContext(ctx, []SQLUpdate{{SQL: sql}})
+		return err
+	}
+}
+
+func TestPropagationRequiresNewLeavesContextTransaction(t *testing.T) {
+	factory, rds, fdb := newFakeFactory(t)
+	audit := factory.CreateWithOptionsContext(PropagationRequiresNew, TxOptions{}, execUpdateContext(rds, "INSERT INTO audit VALUES (1)"))
+
+	err := rds.WithTransaction(context.Background(), func(ctx context.Context) error {
+		if err := execUpdateContext(rds, "INSERT INTO t VALUES (1)")(ctx); err != nil {
+			return err
+		}
+		if err := audit(ctx); err != nil {
+			return err
+		}
+		return assert.AnError
+	})
+
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, []string{
+		"c1 BEGIN",
+		"c1 INSERT INTO t VALUES (1) []",
+		"c2 BEGIN",
+		"c2 INSERT INTO audit VALUES (1) []",
+		"c2 COMMIT",
+		"c1 ROLLBACK",
+	}, fdb.Events())
+	assert.Equal(t, 0, factory.txManagerPool.getNumTransactionManagers())
+}
+
+func TestPropagationNotSupportedLeavesContextTransaction(t *testing.T) {
+	factory, rds, fdb := newFakeFactory(t)
+	outside := factory.CreateWithOptionsContext(PropagationNotSupported, TxOptions{}, func(ctx context.Context) error {
+		if _, ok := rds.activeTransactionManager(ctx); ok {
+			t.Error("transaction active under PropagationNotSupported")
+		}
+		return execUpdateContext(rds, "INSERT INTO audit VALUES (1)")(ctx)
+	})
+
+	err := rds.WithTransaction(context.Background(), func(ctx context.Context) error {
+		if err := execUpdateContext(rds, "INSERT INTO t VALUES (1)")(ctx); err != nil {
+			return err
+		}
+		return outside(ctx)
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"c1 BEGIN",
+		"c1 INSERT INTO t VALUES (1) []",
+		"c2 INSERT INTO audit VALUES (1) []",
+		"c1 COMMIT",
+	}, fdb.Events())
+}
+
+func TestJoiningPropagationsUseContextTransaction(t *testing.T) {
+	for _, propagation := range []Propagation{PropagationRequired, PropagationSupports, PropagationMandatory} {
+		factory, rds, fdb := newFakeFactory(t)
+		joined := factory.CreateWithOptionsContext(propagation, TxOptions{}, func(ctx context.Context) error {
+			// Statements run without the context join the transaction too.
+			return execUpdate(rds, "INSERT INTO t VALUES (2)")()
+		})
+
+		err := rds.WithTransaction(context.Background(), func(ctx context.Context) error {
+			if err := execUpdateContext(rds, "INSERT INTO t VALUES (1)")(ctx); err != nil {
+				return err
+			}
+			return joined(ctx)
+		})
+
+		assert.NoError(t, err, "propagation %d", propagation)
+		assert.Equal(t, []string{
+			"c1 BEGIN",
+			"c1 INSERT INTO t VALUES (1) []",
+			"c1 INSERT INTO t VALUES (2) []",
+			"c1 COMMIT",
+		}, fdb.Events(), "propagation %d", propagation)
+		assert.Equal(t, 0, factory.txManagerPool.getNumTransactionManagers())
+	}
+}
+
+func TestPropagationRequiredFailureMarksContextTransactionRollbackOnly(t *testing.T) {
+	factory, rds, fdb := newFakeFactory(t)
+	failing := factory.CreateWithOptionsContext(PropagationRequired, TxOptions{}, func(ctx context.Context) error {
+		return assert.AnError
+	})
+
+	err := rds.WithTransaction(context.Background(), func(ctx context.Context) error {
+		if err := execUpdateContext(rds, "INSERT INTO t VALUES (1)")(ctx); err != nil {
+			return err
+		}
+		assert.ErrorIs(t, failing(ctx), assert.AnError)
+		return nil
+	})
+
+	assert.ErrorIs(t, err, ErrRollbackOnly)
+	assert.Equal(t, []string{"c1 BEGIN", "c1 INSERT INTO t VALUES (1) []", "c1 ROLLBACK"}, fdb.Events())
+}
+
+func TestPropagationNestedUsesSavepointOfContextTransaction(t *testing.T) {
+	factory, rds, fdb := newFakeFactory(t)
+	nested := factory.CreateWithOptionsContext(PropagationNested, TxOptions{}, func(ctx context.Context) error {
+		if err := execUpdateContext(rds, "INSERT INTO t VALUES (2)")(ctx); err != nil {
+			return err
+		}
+		return assert.AnError
+	})
+
+	err := rds.WithTransaction(context.Background(), func(ctx context.Context) error {
+		if err := execUpdateContext(rds, "INSERT INTO t VALUES (1)")(ctx); err != nil {
+			return err
+		}
+		assert.ErrorIs(t, nested(ctx), assert.AnError)
+		return execUpdateContext(rds, "INSERT INTO t VALUES (3)")(ctx)
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"c1 BEGIN",
+		"c1 INSERT INTO t VALUES (1) []",
+		"c1 SAVEPOINT sp_1 []",
+		"c1 INSERT INTO t VALUES (2) []",
+		"c1 ROLLBACK TO SAVEPOINT sp_1 []",
+		"c1 INSERT INTO t VALUES (3) []",
+		"c1 COMMIT",
+	}, fdb.Events())
+}
+
+func TestPropagationNeverFailsInContextTransaction(t *testing.T) {
+	factory, rds, fdb := newFakeFactory(t)
+	never := factory.CreateWithOptionsContext(PropagationNever, TxOptions{}, execUpdateContext(rds, "INSERT INTO t VALUES (2)"))
+
+	err := rds.WithTransaction(context.Background(), never)
+
+	assert.ErrorIs(t, err, ErrTransactionExists)
+	assert.Empty(t, fdb.Events())
+	assert.NoError(t, never(WithoutTransaction(context.Background())))
+}
+
+func TestExecuteFunctionsContextJoinsContextTransaction(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+
+	err := rds.WithTransaction(context.Background(), func(ctx context.Context) error {
+		if err := execUpdateContext(rds, "INSERT INTO t VALUES (1)")(ctx); err != nil {
+			return err
+		}
+		return rds.ExecuteFunctionsContext(ctx, []func() error{execUpdate(rds, "INSERT INTO t VALUES (2)")})
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"c1 BEGIN",
+		"c1 INSERT INTO t VALUES (1) []",
+		"c1 INSERT INTO t VALUES (2) []",
+		"c1 COMMIT",
+	}, fdb.Events())
+	assert.Equal(t, 0, rds.txManagerPool.getNumTransactionManagers())
+}
+
+func TestExecuteFunctionsWithRetryContextRunsOnceInContextTransaction(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	failFirstExecs(fdb, 1, &mysql.MySQLError{Number: 1213, Message: "Deadlock found"})
+
+	err := rds.WithTransaction(context.Background(), func(ctx context.Context) error {
+		return rds.ExecuteFunctionsWithRetryContext(ctx, DefaultRetryPolicy(), TxOptions{},
+			[]func() error{execUpdate(rds, "UPDATE t SET n = 1")})
+	})
+
+	assert.True(t, IsRetryable(err))
+	assert.Equal(t, []string{"c1 BEGIN", "c1 UPDATE t SET n = 1 []", "c1 ROLLBACK"}, fdb.Events())
+}
@@ -1,6 +1,40 @@
 package db
 
-import "log"
+import (
+	"context"
+	"errors"
+	"log"
+)
+
+// Propagation decides how a decorated function relates to the transaction, if any,
+// already active for the calling goroutine or the context it is called with.
+type Propagation int
+
+const (
+	// PropagationRequired joins the current transaction or starts a new one.
+	PropagationRequired Propagation = iota
+	// PropagationRequiresNew suspends the current transaction and runs in a new one
+	// on a fresh connection; the outer transaction resumes afterwards.
+	PropagationRequiresNew
+	// PropagationNested runs in a savepoint of the current transaction, or in a new
+	// transaction if there is none.
+	PropagationNested
+	// PropagationSupports joins the current transaction, or runs without one.
+	PropagationSupports
+	// PropagationNotSupported suspends the current transaction and runs without one.
+	PropagationNotSupported
+	// PropagationMandatory joins the current transaction and fails if there is none.
+	PropagationMandatory
+	// PropagationNever runs without a transaction and fails if there is one.
+	PropagationNever
+)
+
+var (
+	// ErrNoTransaction is returned for PropagationMandatory when no transaction is active.
+	ErrNoTransaction = errors.New("no active transaction for mandatory propagation")
+	// ErrTransactionExists is returned for PropagationNever when a transaction is active.
+	ErrTransactionExists = errors.New("active transaction found for never propagation")
+)
 
 type TransactionDecoratorFactory struct {
 	txManagerPool *TransactionManagerRegistry
@@ -10,40 +44,138 @@ func NewTransactionDecoratorFactory(txManagerPool *TransactionManagerRegistry) *
 	return &TransactionDecoratorFactory{txManagerPool: txManagerPool}
 }
 
+// Create wraps f so it runs with PropagationRequired.
 func (factory *TransactionDecoratorFactory) Create(f func() error) func() error {
+	return factory.CreateWithPropagation(PropagationRequired, f)
+}
+
+// CreateWithPropagation wraps f so it runs in a transaction according to propagation.
+func (factory *TransactionDecoratorFactory) CreateWithPropagation(propagation Propagation, f func() error) func() error {
+	return factory.CreateWithOptions(propagation, TxOptions{}, f)
+}
+
+// CreateWithOptions wraps f so it runs in a transaction according to propagation.
+// A transaction started for f begins with opts; joining one fails with
+// ErrIncompatibleIsolation if opts asks for a stronger isolation level.
+func (factory *TransactionDecoratorFactory) CreateWithOptions(propagation Propagation, opts TxOptions, f func() error) func() error {
+	decorated := factory.CreateWithOptionsContext(propagation, opts, func(context.Context) error { return f() })
 	return func() error {
-		// Register a transaction manager.
-		factory.txManagerPool.Register()
-
-		// Handle transaction lifecycle.
-		defer func() {
-			if r := recover(); r != nil {
-				// Rollback in case of a panic.
-				err := factory.txManagerPool.Release(false)
-				if err != nil {
-					log.Printf("Failed to rollback transaction: %v", err)
-				}
-				panic(r) // Re-throw the panic.
+		return decorated(context.Background())
+	}
+}
+
+// CreateWithOptionsContext is CreateWithOptions for a function taking a context. A
+// transaction started for f is bound to the context the decorated function is called
+// with: once it is done the running statement is cancelled, the transaction rolled
+// back and its Err() returned. A joined transaction stays bound to its own context.
+//
+// The current transaction is the one active for that context, so one carried by a
+// context from WithTransaction counts as well as one registered for the goroutine; f
+// is called with a context carrying the transaction it runs in, or none at all.
+func (factory *TransactionDecoratorFactory) CreateWithOptionsContext(propagation Propagation, opts TxOptions, f func(ctx context.Context) error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		registry := factory.txManagerPool
+		if txManager, ok := registry.contextTransaction(ctx); ok {
+			return factory.runInContextTransaction(ctx, txManager, propagation, opts, f)
+		}
+		_, active := registry.activeTransactionManager(ctx)
+		if !active {
+			// ctx bypasses the goroutine's transaction, if one is registered.
+			defer registry.resume(registry.suspend())
+		}
+
+		switch propagation {
+		case PropagationRequiresNew:
+			defer registry.resume(registry.suspend())
+			return factory.runInTransaction(ctx, f, false, opts)
+		case PropagationNested:
+			return factory.runInTransaction(ctx, f, true, opts)
+		case PropagationSupports:
+			if !active {
+				return f(ctx)
+			}
+			return factory.runInTransaction(ctx, f, registry.nested, opts)
+		case PropagationNotSupported:
+			defer registry.resume(registry.suspend())
+			return f(WithoutTransaction(ctx))
+		case PropagationMandatory:
+			if !active {
+				return ErrNoTransaction
 			}
-		}()
-
-		// Execute the decorated function.
-		err := f()
-		if err != nil {
-			// Rollback on error.
-			releaseErr := factory.txManagerPool.Release(false)
-			if releaseErr != nil {
-				log.Printf("Failed to rollback transaction: %v", releaseErr)
+			return factory.runInTransaction(ctx, f, registry.nested, opts)
+		case PropagationNever:
+			if active {
+				return ErrTransactionExists
 			}
-			return err
+			return f(ctx)
+		default:
+			return factory.runInTransaction(ctx, f, registry.nested, opts)
 		}
+	}
+}
+
+// runInContextTransaction runs f according to propagation when the current transaction,
+// txManager, is carried by ctx rather than registered for the goroutine.
+func (factory *TransactionDecoratorFactory) runInContextTransaction(ctx context.Context, txManager *TransactionManager, propagation Propagation, opts TxOptions, f func(ctx context.Context) error) error {
+	registry := factory.txManagerPool
+	switch propagation {
+	case PropagationRequiresNew:
+		defer registry.resume(registry.suspend())
+		return factory.runInTransaction(ctx, f, false, opts)
+	case PropagationNotSupported:
+		defer registry.resume(registry.suspend())
+		return f(WithoutTransaction(ctx))
+	case PropagationNever:
+		return ErrTransactionExists
+	case PropagationNested:
+		return registry.joinContextTransaction(ctx, txManager, opts, true, f)
+	default:
+		return registry.joinContextTransaction(ctx, txManager, opts, registry.nested, f)
+	}
+}
+
+// runInTransaction runs f between a Register and Release, opening a savepoint level
+// when savepoint is true and a transaction is already registered. Propagations that
+// join a transaction pass the registry's nested mode, so they behave like Register.
+func (factory *TransactionDecoratorFactory) runInTransaction(ctx context.Context, f func(ctx context.Context) error, savepoint bool, opts TxOptions) error {
+	// Register a transaction manager.
+	if err := factory.txManagerPool.register(ctx, savepoint, opts); err != nil {
+		return err
+	}
 
-		// Commit on success.
-		releaseErr := factory.txManagerPool.Release(true)
+	// Handle transaction lifecycle.
+	defer func() {
+		if r := recover(); r != nil {
+			// Rollback in case of a panic.
+			err := factory.txManagerPool.release(false, panicCause(r))
+			if err != nil {
+				log.Printf("Failed to rollback transaction: %v", err)
+			}
+			panic(r) // Re-throw the panic.
+		}
+	}()
+
+	// Execute the decorated function with the transaction in its context, in place of
+	// any other the context carried.
+	txManager, _ := factory.txManagerPool.currentTransactionManager()
+	err := f(contextWithTransaction(ctx, txManager))
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		err = ctxErr
+	}
+	if err != nil {
+		// Rollback on error.
+		releaseErr := factory.txManagerPool.release(false, err)
 		if releaseErr != nil {
-			log.Printf("Failed to commit transaction: %v", releaseErr)
-			return releaseErr
+			log.Printf("Failed to rollback transaction: %v", releaseErr)
 		}
-		return nil
+		return err
+	}
+
+	// Commit on success.
+	releaseErr := factory.txManagerPool.ReleaseContext(ctx, true)
+	if releaseErr != nil {
+		log.Printf("Failed to commit transaction: %v", releaseErr)
+		return releaseErr
 	}
+	return nil
 }
@@ -0,0 +1,193 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newFakeFactory(t *testing.T) (*TransactionDecoratorFactory, *RDSPooledConnection, *fakeDatabase) {
+	pool, fdb := newFakePool(t)
+	tmr := NewTransactionManagerRegistry(pool)
+	return NewTransactionDecoratorFactory(tmr), NewRDSPooledConnection(pool, tmr), fdb
+}
+
+func execUpdate(rds *RDSPooledConnection, sql string) func() error {
+	return func() error {
+		_, _, err := rds.ExecuteUpdates([]SQLUpdate{{SQL: sql}})
+		return err
+	}
+}
+
+func TestPropagationRequiresNewSurvivesOuterRollback(t *testing.T) {
+	factory, rds, fdb := newFakeFactory(t)
+	audit := factory.CreateWithPropagation(PropagationRequiresNew, execUpdate(rds, "INSERT INTO audit VALUES (1)"))
+
+	err := factory.Create(func() error {
+		if err := execUpdate(rds, "UPDATE account SET n = 1")(); err != nil {
+			return err
+		}
+		if err := audit(); err != nil {
+			return err
+		}
+		// The outer transaction is resumed after the inner one commits.
+		assert.True(t, factory.txManagerPool.IsRegistered())
+		if err := execUpdate(rds, "UPDATE account SET n = 2")(); err != nil {
+			return err
+		}
+		return assert.AnError
+	})()
+
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, []string{
+		"c1 BEGIN",
+		"c1 UPDATE account SET n = 1 []",
+		"c2 BEGIN",
+		"c2 INSERT INTO audit VALUES (1) []",
+		"c2 COMMIT",
+		"c1 UPDATE account SET n = 2 []",
+		"c1 ROLLBACK",
+	}, fdb.Events())
+}
+
+func TestPropagationNestedUsesSavepoint(t *testing.T) {
+	factory, rds, fdb := newFakeFactory(t)
+	inner := factory.CreateWithPropagation(PropagationNested, func() error {
+		if err := execUpdate(rds, "INSERT INTO t VALUES (2)")(); err != nil {
+			return err
+		}
+		return assert.AnError
+	})
+
+	err := factory.Create(func() error {
+		if err := execUpdate(rds, "INSERT INTO t VALUES (1)")(); err != nil {
+			return err
+		}
+		assert.ErrorIs(t, inner(), assert.AnError)
+		return nil
+	})()
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"BEGIN",
+		"INSERT INTO t VALUES (1) []",
+		"SAVEPOINT sp_1 []",
+		"INSERT INTO t VALUES (2) []",
+		"ROLLBACK TO SAVEPOINT sp_1 []",
+		"COMMIT",
+	}, fdb.Statements())
+}
+
+func TestPropagationRequiredHonoursNestedMode(t *testing.T) {
+	factory, rds, fdb := newFakeFactory(t)
+	factory.txManagerPool.SetNestedTransactions(true)
+	inner := factory.Create(func() error {
+		if err := execUpdate(rds, "INSERT INTO t VALUES (2)")(); err != nil {
+			return err
+		}
+		return assert.AnError
+	})
+
+	err := factory.Create(func() error {
+		if err := execUpdate(rds, "INSERT INTO t VALUES (1)")(); err != nil {
+			return err
+		}
+		assert.ErrorIs(t, inner(), assert.AnError)
+		return execUpdate(rds, "INSERT INTO t VALUES (3)")()
+	})()
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"c1 BEGIN",
+		"c1 INSERT INTO t VALUES (1) []",
+		"c1 SAVEPOINT sp_1 []",
+		"c1 INSERT INTO t VALUES (2) []",
+		"c1 ROLLBACK TO SAVEPOINT sp_1 []",
+		"c1 INSERT INTO t VALUES (3) []",
+		"c1 COMMIT",
+	}, fdb.Events())
+}
+
+func TestPropagationNotSupportedRunsOutsideTransaction(t *testing.T) {
+	factory, rds, fdb := newFakeFactory(t)
+	outside := factory.CreateWithPropagation(PropagationNotSupported, func() error {
+		assert.False(t, factory.txManagerPool.IsRegistered())
+		return execUpdate(rds, "INSERT INTO log VALUES (1)")()
+	})
+
+	err := factory.Create(func() error {
+		if err := execUpdate(rds, "INSERT INTO t VALUES (1)")(); err != nil {
+			return err
+		}
+		return outside()
+	})()
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"c1 BEGIN",
+		"c1 INSERT INTO t VALUES (1) []",
+		"c2 INSERT INTO log VALUES (1) []",
+		"c1 COMMIT",
+	}, fdb.Events())
+}
+
+func TestPropagationSupports(t *testing.T) {
+	factory, rds, fdb := newFakeFactory(t)
+	supports := factory.CreateWithPropagation(PropagationSupports, execUpdate(rds, "INSERT INTO t VALUES (1)"))
+
+	assert.NoError(t, supports())
+	assert.NoError(t, factory.Create(supports)())
+
+	assert.Equal(t, []string{
+		"INSERT INTO t VALUES (1) []",
+		"BEGIN",
+		"INSERT INTO t VALUES (1) []",
+		"COMMIT",
+	}, fdb.Statements())
+}
+
+func TestPropagationMandatoryAndNever(t *testing.T) {
+	factory, _, fdb := newFakeFactory(t)
+	noop := func() error { return nil }
+	mandatory := factory.CreateWithPropagation(PropagationMandatory, noop)
+	never := factory.CreateWithPropagation(PropagationNever, noop)
+
+	assert.ErrorIs(t, mandatory(), ErrNoTransaction)
+	assert.NoError(t, factory.Create(mandatory)())
+
+	assert.NoError(t, never())
+	assert.ErrorIs(t, factory.Create(never)(), ErrTransactionExists)
+	assert.False(t, factory.txManagerPool.IsRegistered())
+	assert.Empty(t, fdb.Events())
+}
+
+func TestCreateWithOptionsStartsNewTransactionWithIsolation(t *testing.T) {
+	factory, rds, fdb := newFakeFactory(t)
+	report := factory.CreateWithOptions(PropagationRequiresNew, TxOptions{Isolation: sql.LevelSerializable, ReadOnly: true},
+		func() error {
+			_, err := rds.ExecuteQuery("SELECT SUM(n) FROM t", nil, true)
+			return err
+		})
+	hot := TxOptions{Isolation: sql.LevelReadCommitted}
+
+	err := factory.CreateWithOptions(PropagationRequired, hot, func() error {
+		if err := execUpdate(rds, "UPDATE t SET n = 1")(); err != nil {
+			return err
+		}
+		assert.ErrorIs(t, factory.CreateWithOptions(PropagationRequired, TxOptions{Isolation: sql.LevelSerializable}, func() error {
+			return nil
+		})(), ErrIncompatibleIsolation)
+		return report()
+	})()
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"c1 BEGIN Read Committed",
+		"c1 UPDATE t SET n = 1 []",
+		"c2 BEGIN Serializable READ ONLY",
+		"c2 SELECT SUM(n) FROM t []",
+		"c2 COMMIT",
+		"c1 COMMIT",
+	}, fdb.Events())
+}
@@ -0,0 +1,43 @@
+package db
+
+import "context"
+
+// InTx runs f like a function decorated by factory.Create and returns its result: the
+// transaction commits if f succeeds, rolls back if it fails, and a panic is rethrown
+// after rolling back. On error the zero value of T is returned.
+func InTx[T any](factory *TransactionDecoratorFactory, f func() (T, error)) (T, error) {
+	return InTxWithOptions(factory, PropagationRequired, TxOptions{}, f)
+}
+
+// InTxWithOptions is InTx running f according to propagation and opts, like
+// TransactionDecoratorFactory.CreateWithOptions.
+func InTxWithOptions[T any](factory *TransactionDecoratorFactory, propagation Propagation, opts TxOptions, f func() (T, error)) (T, error) {
+	var result T
+	err := factory.CreateWithOptions(propagation, opts, func() error {
+		var err error
+		result, err = f()
+		return err
+	})()
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return result, nil
+}
+
+// InTxContext runs f in the transaction carried by ctx, or a new one, like
+// RDSPooledConnection.WithTransaction and returns its result. On error the zero
+// value of T is returned.
+func InTxContext[T any](ctx context.Context, r *RDSPooledConnection, f func(ctx context.Context) (T, error)) (T, error) {
+	var result T
+	err := r.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		result, err = f(ctx)
+		return err
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return result, nil
+}
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type account struct {
+	ID      int64
+	Balance int
+}
+
+func TestInTxReturnsResultAndCommits(t *testing.T) {
+	factory, rds, fdb := newFakeFactory(t)
+
+	created, err := InTx(factory, func() (account, error) {
+		_, ids, err := rds.ExecuteUpdates([]SQLUpdate{{SQL: "INSERT INTO account (balance) VALUES (?)", Values: [][]interface{}{{10}}}})
+		if err != nil {
+			return account{}, err
+		}
+		return account{ID: ids[0], Balance: 10}, nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, account{ID: 1, Balance: 10}, created)
+	assert.Equal(t, []string{"BEGIN", "INSERT INTO account (balance) VALUES (?) [10]", "COMMIT"}, fdb.Statements())
+}
+
+func TestInTxRollsBackAndReturnsZeroValueOnError(t *testing.T) {
+	factory, rds, fdb := newFakeFactory(t)
+
+	result, err := InTx(factory, func() (*account, error) {
+		if err := execUpdate(rds, "DELETE FROM account")(); err != nil {
+			return nil, err
+		}
+		return &account{ID: 1}, assert.AnError
+	})
+
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Nil(t, result)
+	assert.Equal(t, []string{"BEGIN", "DELETE FROM account []", "ROLLBACK"}, fdb.Statements())
+}
+
+func TestInTxRethrowsPanicAfterRollback(t *testing.T) {
+	factory, rds, fdb := newFakeFactory(t)
+
+	assert.PanicsWithValue(t, "boom", func() {
+		_, _ = InTx(factory, func() (int, error) {
+			_ = execUpdate(rds, "DELETE FROM account")()
+			panic("boom")
+		})
+	})
+	assert.Equal(t, []string{"BEGIN", "DELETE FROM account []", "ROLLBACK"}, fdb.Statements())
+	assert.False(t, factory.txManagerPool.IsRegistered())
+}
+
+func TestInTxContext(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+
+	count, err := InTxContext(context.Background(), rds, func(ctx context.Context) (int64, error) {
+		rowCounts, _, err := rds.ExecuteUpdatesContext(ctx, []SQLUpdate{{SQL: "UPDATE account SET balance = 0"}})
+		if err != nil {
+			return 0, err
+		}
+		return rowCounts[0], nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	assert.Equal(t, []string{"BEGIN", "UPDATE account SET balance = 0 []", "COMMIT"}, fdb.Statements())
+}
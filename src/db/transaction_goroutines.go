@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/anmollp/generic-db-go/src/utils"
+)
+
+// spawn runs fn on a new goroutine that the transaction's Commit waits for. An error
+// or panic from fn marks the transaction rollback-only and is reported by Commit.
+func (tm *TransactionManager) spawn(fn func() error) {
+	tm.children.Add(1)
+	go func() {
+		defer tm.children.Done()
+		defer func() {
+			if rec := recover(); rec != nil {
+				tm.failChild(panicCause(rec))
+			}
+		}()
+
+		if err := fn(); err != nil {
+			tm.failChild(err)
+		}
+	}()
+}
+
+func (tm *TransactionManager) failChild(err error) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	tm.rollbackOnly = true
+	for i, childErr := range tm.childErrs {
+		if errors.Is(err, childErr) {
+			// Already recorded when the child's own unit of work rolled back.
+			tm.childErrs[i] = err
+			return
+		}
+	}
+	tm.childErrs = append(tm.childErrs, err)
+}
+
+// Go runs fn on a new goroutine that shares the transaction registered for the current
+// goroutine: fn's statements run in that transaction, serialized with those of the
+// parent and other children. The transaction does not commit until fn has returned,
+// and an error or panic from fn makes the parent's final Release(true) roll back and
+// return it. So does a unit of work that fn registers and rolls back, e.g. a failing
+// ExecuteFunctions; it never ends the shared transaction itself. Without a registered
+// transaction fn runs on a plain goroutine and its error is logged.
+func (r *TransactionManagerRegistry) Go(fn func() error) {
+	txManager, ok := r.currentTransactionManager()
+	if !ok {
+		go func() {
+			if err := fn(); err != nil {
+				log.Printf("Error in goroutine started outside a transaction: %v", err)
+			}
+		}()
+		return
+	}
+
+	txManager.spawn(func() error {
+		goroutineID := utils.GetGoroutineID()
+		r.txManagers.Store(goroutineID, txManager)
+		r.txTrackers.Store(goroutineID, 1)
+		defer func() {
+			r.txManagers.Delete(goroutineID)
+			r.txTrackers.Delete(goroutineID)
+		}()
+		return fn()
+	})
+}
+
+// GoContext runs fn on a new goroutine with a context carrying the transaction active
+// for ctx, with the same guarantees as TransactionManagerRegistry.Go: statements are
+// serialized on the shared connection, the transaction waits for fn before committing
+// and an error or panic from fn makes it roll back. Without an active transaction fn
+// runs on a plain goroutine and its error is logged.
+func (r *RDSPooledConnection) GoContext(ctx context.Context, fn func(ctx context.Context) error) {
+	txManager, ok := r.activeTransactionManager(ctx)
+	if !ok {
+		go func() {
+			if err := fn(ctx); err != nil {
+				log.Printf("Error in goroutine started outside a transaction: %v", err)
+			}
+		}()
+		return
+	}
+
+	childCtx := contextWithTransaction(ctx, txManager)
+	txManager.spawn(func() error {
+		return fn(childCtx)
+	})
+}
@@ -0,0 +1,178 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// serialExec fails the test if two statements ever run on the fake database at once.
+func serialExec(t *testing.T, fdb *fakeDatabase) {
+	var running int32
+	fdb.onExec = func(query string, args []driver.Value) (driver.Result, error) {
+		if atomic.AddInt32(&running, 1) > 1 {
+			t.Errorf("concurrent statement on the shared connection: %s", query)
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return driver.RowsAffected(1), nil
+	}
+}
+
+func TestRegistryGoRunsChildrenInTransaction(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	tmr := NewTransactionManagerRegistry(pool)
+	rds := NewRDSPooledConnection(pool, tmr)
+	serialExec(t, fdb)
+
+	err := rds.ExecuteFunctions([]func() error{func() error {
+		for i := 0; i < 3; i++ {
+			tmr.Go(execUpdate(rds, "INSERT INTO t VALUES (1)"))
+		}
+		return execUpdate(rds, "INSERT INTO t VALUES (2)")()
+	}})
+
+	assert.NoError(t, err)
+	events := fdb.Events()
+	assert.Len(t, events, 6)
+	assert.Equal(t, "c1 BEGIN", events[0])
+	assert.Equal(t, "c1 COMMIT", events[5])
+	for _, event := range events {
+		assert.Contains(t, event, "c1 ")
+	}
+	assert.Equal(t, 0, tmr.getNumTransactionManagers())
+}
+
+func TestRegistryGoChildErrorRollsBack(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	tmr := NewTransactionManagerRegistry(pool)
+	rds := NewRDSPooledConnection(pool, tmr)
+
+	err := rds.ExecuteFunctions([]func() error{func() error {
+		tmr.Go(func() error {
+			time.Sleep(10 * time.Millisecond)
+			return assert.AnError
+		})
+		return execUpdate(rds, "INSERT INTO t VALUES (1)")()
+	}})
+
+	assert.ErrorIs(t, err, ErrRollbackOnly)
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, []string{"BEGIN", "INSERT INTO t VALUES (1) []", "ROLLBACK"}, fdb.Statements())
+}
+
+func TestGoContextWaitsForChildrenBeforeCommit(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	serialExec(t, fdb)
+
+	err := rds.WithTransaction(context.Background(), func(ctx context.Context) error {
+		for i := 0; i < 3; i++ {
+			rds.GoContext(ctx, func(ctx context.Context) error {
+				time.Sleep(10 * time.Millisecond)
+				_, _, err := rds.ExecuteUpdatesContext(ctx, []SQLUpdate{{SQL: "INSERT INTO t VALUES (1)"}})
+				return err
+			})
+		}
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"c1 BEGIN",
+		"c1 INSERT INTO t VALUES (1) []",
+		"c1 INSERT INTO t VALUES (1) []",
+		"c1 INSERT INTO t VALUES (1) []",
+		"c1 COMMIT",
+	}, fdb.Events())
+}
+
+func TestStatementsAfterRollbackFail(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+
+	var leaked context.Context
+	_ = rds.WithTransaction(context.Background(), func(ctx context.Context) error {
+		leaked = ctx
+		return assert.AnError
+	})
+
+	_, _, err := rds.ExecuteUpdatesContext(leaked, []SQLUpdate{{SQL: "INSERT INTO t VALUES (1)"}})
+	assert.ErrorIs(t, err, sql.ErrTxDone)
+	assert.Empty(t, fdb.Events())
+}
+
+func TestRegistryGoChildUnitOfWorkRollbackLeavesParentTransaction(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	tmr := NewTransactionManagerRegistry(pool)
+	rds := NewRDSPooledConnection(pool, tmr)
+
+	childDone := make(chan struct{})
+	var childErr error
+	err := rds.ExecuteFunctions([]func() error{func() error {
+		tmr.Go(func() error {
+			defer close(childDone)
+			childErr = rds.ExecuteFunctions([]func() error{
+				execUpdate(rds, "INSERT INTO t VALUES (1)"),
+				func() error { return assert.AnError },
+			})
+			return childErr
+		})
+		<-childDone
+		return execUpdate(rds, "INSERT INTO t VALUES (2)")()
+	}})
+
+	assert.ErrorIs(t, childErr, assert.AnError)
+	assert.ErrorIs(t, err, ErrRollbackOnly)
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, 1, strings.Count(err.Error(), assert.AnError.Error()))
+	assert.Equal(t, []string{
+		"c1 BEGIN",
+		"c1 INSERT INTO t VALUES (1) []",
+		"c1 INSERT INTO t VALUES (2) []",
+		"c1 ROLLBACK",
+	}, fdb.Events())
+	assert.Equal(t, 0, tmr.getNumTransactionManagers())
+}
+
+func TestRegistryGoChildrenNeverOpenSavepoints(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	tmr := NewTransactionManagerRegistry(pool)
+	tmr.SetNestedTransactions(true)
+	rds := NewRDSPooledConnection(pool, tmr)
+
+	err := rds.ExecuteFunctions([]func() error{func() error {
+		innerErr := rds.ExecuteFunctions([]func() error{
+			execUpdate(rds, "INSERT INTO t VALUES (1)"),
+			func() error {
+				childDone := make(chan struct{})
+				tmr.Go(func() error {
+					defer close(childDone)
+					return rds.ExecuteFunctions([]func() error{execUpdate(rds, "INSERT INTO t VALUES (2)")})
+				})
+				<-childDone
+				return assert.AnError
+			},
+		})
+		assert.ErrorIs(t, innerErr, assert.AnError)
+		return execUpdate(rds, "INSERT INTO t VALUES (3)")()
+	}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"c1 BEGIN",
+		"c1 SAVEPOINT sp_1 []",
+		"c1 INSERT INTO t VALUES (1) []",
+		"c1 INSERT INTO t VALUES (2) []",
+		"c1 ROLLBACK TO SAVEPOINT sp_1 []",
+		"c1 INSERT INTO t VALUES (3) []",
+		"c1 COMMIT",
+	}, fdb.Events())
+	assert.Equal(t, 0, tmr.getNumTransactionManagers())
+}
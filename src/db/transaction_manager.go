@@ -1,32 +1,278 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"sync"
+	"time"
+
+	"github.com/anmollp/generic-db-go/src/utils"
 )
 
+// ErrIncompatibleIsolation is returned when a nested registration asks for a stronger
+// isolation level than the transaction it would join provides.
+var ErrIncompatibleIsolation = errors.New("requested isolation level is stronger than the active transaction's")
+
+// TxOptions configures the transaction a TransactionManager begins.
+type TxOptions struct {
+	// Isolation is the isolation level, e.g. sql.LevelReadCommitted,
+	// sql.LevelRepeatableRead or sql.LevelSerializable. sql.LevelDefault keeps the
+	// server default, which for InnoDB is REPEATABLE READ.
+	Isolation sql.IsolationLevel
+	// ReadOnly starts the transaction with START TRANSACTION READ ONLY.
+	ReadOnly bool
+}
+
+// effectiveIsolation returns the level a transaction with opts runs at, assuming the
+// server default is REPEATABLE READ.
+func (opts TxOptions) effectiveIsolation() sql.IsolationLevel {
+	if opts.Isolation == sql.LevelDefault {
+		return sql.LevelRepeatableRead
+	}
+	return opts.Isolation
+}
+
+// ErrRollbackOnly is returned by Commit when a nested unit of work failed and
+// marked the transaction rollback-only; the transaction is rolled back instead.
+var ErrRollbackOnly = errors.New("transaction was marked rollback-only")
+
 // TransactionManager manages database connections and transactions.
+// The transaction is begun lazily on the first statement and committed or rolled
+// back as a whole when the manager is released.
 type TransactionManager struct {
 	connectionPool *sql.DB
+	ctx            context.Context
 	conn           *sql.Conn
+	tx             *sql.Tx
+	options        TxOptions
+	savepoints     []savepoint
+	savepointSeq   int
+	callbacks      txCallbacks
+	rollbackOnly   bool
+	registration   registration
+	timeout        *time.Timer
+	timedOut       bool
+	timedOutAt     time.Time
+	finished       bool
+	children       sync.WaitGroup
+	childErrs      []error
+	cursorOwner    int        // Goroutine with a Cursor open in the transaction, or 0.
+	stmtMu         sync.Mutex // Serializes statements from goroutines sharing the transaction.
 	mu             sync.Mutex
 }
 
+// savepoint is a nesting level of a TransactionManagerRegistry in nested mode, opened
+// by the goroutine owner at its registration depth. The SAVEPOINT statement is only
+// issued once a statement runs inside the level.
+type savepoint struct {
+	name    string
+	owner   int
+	depth   int
+	created bool
+}
+
 // NewTransactionManager creates a new TransactionManager with the given connection pool.
 func NewTransactionManager(pool *sql.DB) *TransactionManager {
+	return NewTransactionManagerWithOptions(pool, TxOptions{})
+}
+
+// NewTransactionManagerWithOptions creates a new TransactionManager whose transaction begins with opts.
+func NewTransactionManagerWithOptions(pool *sql.DB, opts TxOptions) *TransactionManager {
 	return &TransactionManager{
 		connectionPool: pool,
+		ctx:            context.Background(),
+		options:        opts,
+	}
+}
+
+// bindContext makes the transaction, once begun, run under ctx: when ctx is done the
+// running statement is cancelled and the transaction rolled back.
+func (tm *TransactionManager) bindContext(ctx context.Context) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	tm.ctx = ctx
+}
+
+// statementContext returns a context for a statement run with ctx inside the
+// transaction, also done when the transaction's own context is. The returned cancel
+// func must be called once the statement is done.
+func (tm *TransactionManager) statementContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	tm.mu.Lock()
+	txCtx := tm.ctx
+	tm.mu.Unlock()
+
+	if txCtx.Done() == nil || txCtx == ctx {
+		return ctx, func() {}
+	}
+
+	var cancel context.CancelFunc
+	if deadline, ok := txCtx.Deadline(); ok {
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
 	}
+	stop := context.AfterFunc(txCtx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// Options returns the options the manager's transaction begins with.
+func (tm *TransactionManager) Options() TxOptions {
+	return tm.options
+}
+
+// checkJoin reports whether a registration asking for opts may join this transaction.
+func (tm *TransactionManager) checkJoin(opts TxOptions) error {
+	if opts.Isolation != sql.LevelDefault && opts.Isolation > tm.options.effectiveIsolation() {
+		return fmt.Errorf("%w: %s requested inside a %s transaction",
+			ErrIncompatibleIsolation, opts.Isolation, tm.options.effectiveIsolation())
+	}
+	return nil
 }
 
-// GetConnection returns a connection from the pool, creating one if necessary.
+// GetConnection returns a connection from the pool, creating one if necessary. The
+// connection is taken with the context the transaction is bound to.
 func (tm *TransactionManager) GetConnection() (*sql.Conn, error) {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
+	return tm.getConnection()
+}
+
+// GetTransaction returns the transaction on the manager's connection, beginning it if necessary.
+func (tm *TransactionManager) GetTransaction() (*sql.Tx, error) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	if tm.timedOut {
+		return nil, ErrTransactionTimeout
+	}
+	if tm.finished {
+		return nil, sql.ErrTxDone
+	}
+
+	if tm.tx == nil {
+		conn, err := tm.getConnection()
+		if err != nil {
+			return nil, err
+		}
+		tx, err := conn.BeginTx(tm.ctx, &sql.TxOptions{
+			Isolation: tm.options.Isolation,
+			ReadOnly:  tm.options.ReadOnly,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		tm.tx = tx
+	}
+
+	for i := range tm.savepoints {
+		if tm.savepoints[i].created {
+			continue
+		}
+		if _, err := tm.tx.ExecContext(tm.ctx, "SAVEPOINT "+tm.savepoints[i].name); err != nil {
+			return nil, fmt.Errorf("failed to create savepoint: %w", err)
+		}
+		tm.savepoints[i].created = true
+	}
+	return tm.tx, nil
+}
+
+// pushSavepoint opens a savepoint level for owner's registration at depth. Savepoints
+// are numbered per transaction, so levels opened by different goroutines never share a name.
+func (tm *TransactionManager) pushSavepoint(owner, depth int) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	tm.savepointSeq++
+	tm.savepoints = append(tm.savepoints, savepoint{
+		name:  fmt.Sprintf("sp_%d", tm.savepointSeq),
+		owner: owner,
+		depth: depth,
+	})
+}
+
+// savepointDepth returns the registration depth of owner's innermost savepoint level.
+func (tm *TransactionManager) savepointDepth(owner int) (int, bool) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	if i := tm.innermostSavepoint(owner); i >= 0 {
+		return tm.savepoints[i].depth, true
+	}
+	return 0, false
+}
+
+// releaseSavepoint closes owner's innermost savepoint level, keeping its work.
+func (tm *TransactionManager) releaseSavepoint(owner int) error {
+	tm.stmtMu.Lock()
+	defer tm.stmtMu.Unlock()
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	level := tm.innermostSavepoint(owner)
+	sp := tm.removeSavepoint(level)
+	tm.callbacks.promote(level)
+	return tm.execSavepoint("RELEASE SAVEPOINT ", sp)
+}
+
+// rollbackToSavepoint closes owner's innermost savepoint level, undoing its work.
+// Callbacks registered inside the level are discarded, running its OnRollback
+// callbacks with cause.
+func (tm *TransactionManager) rollbackToSavepoint(owner int, cause error) error {
+	tm.stmtMu.Lock()
+	tm.mu.Lock()
+	level := tm.innermostSavepoint(owner)
+	sp := tm.removeSavepoint(level)
+	discarded := tm.callbacks.splitAbove(level)
+	err := tm.execSavepoint("ROLLBACK TO SAVEPOINT ", sp)
+	tm.mu.Unlock()
+	tm.stmtMu.Unlock()
+
+	discarded.rolledBack(cause)
+	return err
+}
+
+// innermostSavepoint returns the index of owner's innermost savepoint level, or -1.
+func (tm *TransactionManager) innermostSavepoint(owner int) int {
+	for i := len(tm.savepoints) - 1; i >= 0; i-- {
+		if tm.savepoints[i].owner == owner {
+			return i
+		}
+	}
+	return -1
+}
+
+func (tm *TransactionManager) removeSavepoint(i int) savepoint {
+	sp := tm.savepoints[i]
+	tm.savepoints = append(tm.savepoints[:i], tm.savepoints[i+1:]...)
+	return sp
+}
+
+func (tm *TransactionManager) execSavepoint(statement string, sp savepoint) error {
+	if tm.timedOut {
+		return ErrTransactionTimeout
+	}
+	if !sp.created {
+		return nil
+	}
+	if tm.tx == nil {
+		return sql.ErrTxDone
+	}
+	if _, err := tm.tx.ExecContext(context.Background(), statement+sp.name); err != nil {
+		return fmt.Errorf("failed to close savepoint %s: %w", sp.name, err)
+	}
+	return nil
+}
+
+func (tm *TransactionManager) getConnection() (*sql.Conn, error) {
 	if tm.conn == nil {
-		conn, err := tm.connectionPool.Conn(nil)
+		conn, err := tm.connectionPool.Conn(tm.ctx)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get connection: %w", err)
 		}
@@ -35,43 +281,123 @@ func (tm *TransactionManager) GetConnection() (*sql.Conn, error) {
 	return tm.conn, nil
 }
 
-// Commit commits the current transaction and closes the connection.
-func (tm *TransactionManager) Commit() error {
+// openCursor records owner as the goroutine with a Cursor open in the transaction, or
+// that none is open if owner is 0.
+func (tm *TransactionManager) openCursor(owner int) {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
-	if tm.conn == nil {
-		return nil
+	tm.cursorOwner = owner
+}
+
+// cursorOpenHere reports whether the calling goroutine has a Cursor open in the transaction.
+func (tm *TransactionManager) cursorOpenHere() bool {
+	tm.mu.Lock()
+	owner := tm.cursorOwner
+	tm.mu.Unlock()
+
+	return owner != 0 && owner == utils.GetGoroutineID()
+}
+
+// SetRollbackOnly marks the transaction so that Commit rolls it back instead.
+func (tm *TransactionManager) SetRollbackOnly() {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	tm.rollbackOnly = true
+}
+
+// Commit commits the current transaction and closes the connection, then runs the
+// OnCommit callbacks. It first waits for goroutines started in the transaction with
+// Go or GoContext. A transaction marked rollback-only is rolled back and
+// ErrRollbackOnly returned; when the transaction does not commit the OnRollback
+// callbacks run instead, with the error.
+func (tm *TransactionManager) Commit() error {
+	tm.children.Wait()
+	tm.stmtMu.Lock()
+	err := tm.commit()
+	tm.stmtMu.Unlock()
+	callbacks := tm.takeCallbacks()
+	if err != nil {
+		callbacks.rolledBack(err)
+		return err
 	}
+	callbacks.committed()
+	return nil
+}
+
+func (tm *TransactionManager) commit() error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
 	defer tm.closeConnection()
 
-	tx, err := tm.conn.BeginTx(nil, nil)
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+	tm.stopTimeout()
+	tm.finished = true
+	if tm.timedOut {
+		return ErrTransactionTimeout
+	}
+
+	if tm.rollbackOnly {
+		if err := tm.rollbackLocked(); err != nil {
+			return err
+		}
+		if len(tm.childErrs) > 0 {
+			return fmt.Errorf("%w: %w", ErrRollbackOnly, errors.Join(tm.childErrs...))
+		}
+		return ErrRollbackOnly
 	}
 
+	if tm.tx == nil {
+		return nil
+	}
+
+	tx := tm.tx
+	tm.tx = nil
 	if err := tx.Commit(); err != nil {
+		if errors.Is(err, sql.ErrTxDone) && tm.ctx.Err() != nil {
+			// database/sql already rolled back when the bound context ended.
+			return tm.ctx.Err()
+		}
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 	return nil
 }
 
-// Rollback rolls back the current transaction and closes the connection.
+// Rollback rolls back the current transaction and closes the connection, then runs
+// the OnRollback callbacks with a nil error.
 func (tm *TransactionManager) Rollback() error {
+	return tm.rollback(nil)
+}
+
+// rollback is Rollback passing cause, the error that failed the unit of work, to the
+// OnRollback callbacks.
+func (tm *TransactionManager) rollback(cause error) error {
+	err := tm.rollbackTx()
+	tm.takeCallbacks().rolledBack(cause)
+	return err
+}
+
+func (tm *TransactionManager) rollbackTx() error {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
-
-	if tm.conn == nil {
-		return nil
-	}
 	defer tm.closeConnection()
 
-	tx, err := tm.conn.BeginTx(nil, nil)
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+	tm.stopTimeout()
+	tm.finished = true
+	return tm.rollbackLocked()
+}
+
+func (tm *TransactionManager) rollbackLocked() error {
+	if tm.tx == nil {
+		return nil
 	}
 
+	tx := tm.tx
+	tm.tx = nil
 	if err := tx.Rollback(); err != nil {
+		if errors.Is(err, sql.ErrTxDone) && tm.ctx.Err() != nil {
+			return nil // Already rolled back when the bound context ended.
+		}
 		return fmt.Errorf("failed to roll back transaction: %w", err)
 	}
 	return nil
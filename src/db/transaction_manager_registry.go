@@ -1,9 +1,12 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"github.com/anmollp/generic-db-go/src/utils"
 	"sync"
+	"time"
 )
 
 // TransactionManagerRegistry manages a TransactionManager for each goroutine.
@@ -11,6 +14,8 @@ type TransactionManagerRegistry struct {
 	connectionPool *sql.DB
 	txManagers     sync.Map // Thread-safe map to store TransactionManagers
 	txTrackers     sync.Map // Thread-safe map to store usage counters
+	nested         bool
+	timeout        time.Duration
 }
 
 // Helper methods for managing the tracker count.
@@ -48,20 +53,89 @@ func NewTransactionManagerRegistry(pool *sql.DB) *TransactionManagerRegistry {
 	}
 }
 
+// SetNestedTransactions turns nested mode on or off. In nested mode every Register
+// made while a TransactionManager is already registered opens a SAVEPOINT, and the
+// matching Release commits or rolls back only the work done since that savepoint.
+// Goroutines started with Go are the exception: their registrations join the shared
+// transaction without a savepoint.
+func (r *TransactionManagerRegistry) SetNestedTransactions(enabled bool) {
+	r.nested = enabled
+}
+
 // Register registers a TransactionManager for the current goroutine.
 func (r *TransactionManagerRegistry) Register() {
+	_ = r.register(context.Background(), r.nested, TxOptions{})
+}
+
+// RegisterWithOptions registers a TransactionManager for the current goroutine whose
+// transaction begins with opts. If one is already registered it is joined instead,
+// and ErrIncompatibleIsolation is returned, without registering, when opts asks for
+// a stronger isolation level than the joined transaction provides.
+func (r *TransactionManagerRegistry) RegisterWithOptions(opts TxOptions) error {
+	return r.register(context.Background(), r.nested, opts)
+}
+
+// RegisterContext is RegisterWithOptions binding a new transaction to ctx: when ctx is
+// done the running statement is cancelled and the transaction rolled back. A joined
+// transaction stays bound to the context it was registered with; ctx then only ends
+// the unit of work when it is released with ReleaseContext.
+func (r *TransactionManagerRegistry) RegisterContext(ctx context.Context, opts TxOptions) error {
+	return r.register(ctx, r.nested, opts)
+}
+
+// register registers a TransactionManager for the current goroutine, opening a
+// savepoint level if one is already registered and savepoint is true. A new
+// TransactionManager is bound to ctx.
+func (r *TransactionManagerRegistry) register(ctx context.Context, savepoint bool, opts TxOptions) error {
 	goroutineID := utils.GetGoroutineID()
-	_, managerExists := r.txManagers.Load(goroutineID)
+	manager, managerExists := r.txManagers.Load(goroutineID)
 	if !managerExists {
-		r.txManagers.Store(goroutineID, NewTransactionManager(r.connectionPool))
+		txManager := NewTransactionManagerWithOptions(r.connectionPool, opts)
+		txManager.bindContext(ctx)
+		txManager.registration = newRegistration(goroutineID)
+		if r.timeout > 0 {
+			txManager.startTimeout(r.timeout)
+		}
+		r.txManagers.Store(goroutineID, txManager)
 		r.txTrackers.Store(goroutineID, 0)
+	} else {
+		txManager := manager.(*TransactionManager)
+		if err := txManager.checkJoin(opts); err != nil {
+			return err
+		}
+		// Goroutines started with Go never open savepoints: they run concurrently with
+		// their parent, so rolling back to one could undo the parent's work too.
+		if savepoint && goroutineID == txManager.registration.goroutineID {
+			txManager.pushSavepoint(goroutineID, r.getTrackerCount(goroutineID)+1)
+		}
 	}
 	r.incrementTracker(goroutineID)
+	return nil
 }
 
 // Release releases the TransactionManager for the current goroutine.
 // Commits the transaction if `commit` is true, otherwise rolls it back.
+// Releasing a savepoint level only releases or rolls back to that savepoint.
+// Rolling back an inner registration rolls back the whole transaction at once, but
+// the manager stays registered until the outermost Release: statements in between
+// fail with sql.ErrTxDone and a final Release(true) returns ErrRollbackOnly.
 func (r *TransactionManagerRegistry) Release(commit bool) error {
+	return r.release(commit, nil)
+}
+
+// ReleaseContext is Release that rolls back instead of committing once ctx is done,
+// returning ctx.Err().
+func (r *TransactionManagerRegistry) ReleaseContext(ctx context.Context, commit bool) error {
+	if err := ctx.Err(); err != nil && commit {
+		_ = r.release(false, err)
+		return err
+	}
+	return r.Release(commit)
+}
+
+// release is Release passing cause, the error that failed the unit of work, to the
+// OnRollback callbacks when rolling back.
+func (r *TransactionManagerRegistry) release(commit bool, cause error) error {
 	goroutineID := utils.GetGoroutineID()
 
 	manager, ok := r.txManagers.Load(goroutineID)
@@ -70,10 +144,31 @@ func (r *TransactionManagerRegistry) Release(commit bool) error {
 	}
 	txManager := manager.(*TransactionManager)
 
+	if goroutineID != txManager.registration.goroutineID {
+		return r.releaseChild(goroutineID, txManager, commit, cause)
+	}
+
+	if depth, ok := txManager.savepointDepth(goroutineID); ok && depth == r.getTrackerCount(goroutineID) {
+		r.decrementTracker(goroutineID)
+		if commit {
+			return txManager.releaseSavepoint(goroutineID)
+		}
+		return txManager.rollbackToSavepoint(goroutineID, cause)
+	}
+
+	if !commit && r.getTrackerCount(goroutineID) > 1 {
+		// An inner unit of work failed: end the transaction now, but leave it registered
+		// so the outer units' statements fail with sql.ErrTxDone instead of running
+		// autocommitted, and their final Release(true) reports ErrRollbackOnly.
+		r.decrementTracker(goroutineID)
+		txManager.SetRollbackOnly()
+		return txManager.rollback(cause)
+	}
+
 	if !commit {
 		r.txManagers.Delete(goroutineID)
 		r.txTrackers.Delete(goroutineID)
-		return txManager.Rollback()
+		return txManager.rollback(cause)
 	}
 
 	// Decrement tracker and commit only when all components have released.
@@ -86,6 +181,23 @@ func (r *TransactionManagerRegistry) Release(commit bool) error {
 	return nil
 }
 
+// releaseChild releases a registration made on a goroutine started with Go, which
+// shares its parent's transaction. Only the parent ends that transaction: a rollback
+// marks it rollback-only, recording cause for the parent's final Release(true), and
+// only the child's own registration is released.
+func (r *TransactionManagerRegistry) releaseChild(goroutineID int, txManager *TransactionManager, commit bool, cause error) error {
+	if r.getTrackerCount(goroutineID) > 1 {
+		r.decrementTracker(goroutineID)
+	}
+	if !commit {
+		if cause == nil {
+			cause = errors.New("rolled back in a goroutine started with Go")
+		}
+		txManager.failChild(cause)
+	}
+	return nil
+}
+
 // GetTransactionManager retrieves the TransactionManager for the current goroutine.
 // Panics if no TransactionManager is registered.
 func (r *TransactionManagerRegistry) GetTransactionManager() *TransactionManager {
@@ -97,6 +209,49 @@ func (r *TransactionManagerRegistry) GetTransactionManager() *TransactionManager
 	return manager.(*TransactionManager)
 }
 
+// suspendedTransaction is a TransactionManager taken off a goroutine by suspend,
+// together with its usage counter.
+type suspendedTransaction struct {
+	manager *TransactionManager
+	count   int
+}
+
+// suspend unregisters the current goroutine's TransactionManager without ending its
+// transaction, so a new one can be registered. It returns nil if none is registered.
+func (r *TransactionManagerRegistry) suspend() *suspendedTransaction {
+	goroutineID := utils.GetGoroutineID()
+	manager, ok := r.txManagers.Load(goroutineID)
+	if !ok {
+		return nil
+	}
+	suspended := &suspendedTransaction{
+		manager: manager.(*TransactionManager),
+		count:   r.getTrackerCount(goroutineID),
+	}
+	r.txManagers.Delete(goroutineID)
+	r.txTrackers.Delete(goroutineID)
+	return suspended
+}
+
+// resume registers a TransactionManager returned by suspend on the current goroutine again.
+func (r *TransactionManagerRegistry) resume(suspended *suspendedTransaction) {
+	if suspended == nil {
+		return
+	}
+	goroutineID := utils.GetGoroutineID()
+	r.txManagers.Store(goroutineID, suspended.manager)
+	r.txTrackers.Store(goroutineID, suspended.count)
+}
+
+// currentTransactionManager returns the TransactionManager registered for the current goroutine, if any.
+func (r *TransactionManagerRegistry) currentTransactionManager() (*TransactionManager, bool) {
+	manager, ok := r.txManagers.Load(utils.GetGoroutineID())
+	if !ok {
+		return nil, false
+	}
+	return manager.(*TransactionManager), true
+}
+
 func (r *TransactionManagerRegistry) getNumTransactionManagers() int {
 	length := 0
 	r.txManagers.Range(func(key, value interface{}) bool {
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"database/sql"
 	"github.com/anmollp/generic-db-go/src/utils"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/stretchr/testify/assert"
@@ -104,8 +105,228 @@ func TestTransactionManagerReleaseLifeCycle(t *testing.T) {
 	tmr.Register()
 	tmr.Register()
 
-	// Rollbacks will always be done immediately even if tx manager is registered multiple times
-	tmr.Release(false)
+	// Rollbacks will always be done immediately even if tx manager is registered multiple times,
+	// but the manager stays registered until the outermost release.
+	assert.NoError(t, tmr.Release(false))
+	assert.Equal(t, tmr.getNumTransactionManagers(), 1)
+	assert.Equal(t, tmr.getNumTransactionManagerTrackers(), 1)
+
+	assert.ErrorIs(t, tmr.Release(true), ErrRollbackOnly)
 	assert.Equal(t, tmr.getNumTransactionManagers(), 0)
 	assert.Equal(t, tmr.getNumTransactionManagerTrackers(), 0)
 }
+
+func TestExecuteFunctionsRunsStatementsInOneTransaction(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	tmr := NewTransactionManagerRegistry(pool)
+	rds := NewRDSPooledConnection(pool, tmr)
+
+	insert := func(name string) func() error {
+		return func() error {
+			_, _, err := rds.ExecuteUpdates([]SQLUpdate{{SQL: "INSERT INTO t (name) VALUES (?)", Values: [][]interface{}{{name}}}})
+			return err
+		}
+	}
+	err := rds.ExecuteFunctions([]func() error{insert("a"), insert("b")})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"c1 BEGIN",
+		"c1 INSERT INTO t (name) VALUES (?) [a]",
+		"c1 INSERT INTO t (name) VALUES (?) [b]",
+		"c1 COMMIT",
+	}, fdb.Events())
+}
+
+func TestExecuteFunctionsRollsBackStatementsOnError(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	tmr := NewTransactionManagerRegistry(pool)
+	rds := NewRDSPooledConnection(pool, tmr)
+
+	err := rds.ExecuteFunctions([]func() error{
+		func() error {
+			_, _, err := rds.ExecuteUpdates([]SQLUpdate{{SQL: "DELETE FROM t"}})
+			return err
+		},
+		func() error {
+			return assert.AnError
+		},
+	})
+
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, []string{"BEGIN", "DELETE FROM t []", "ROLLBACK"}, fdb.Statements())
+	assert.Equal(t, 0, tmr.getNumTransactionManagers())
+}
+
+func TestInnerRollbackFailsOuterUnitOfWork(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	tmr := NewTransactionManagerRegistry(pool)
+	rds := NewRDSPooledConnection(pool, tmr)
+
+	update := func(sql string) func() error {
+		return func() error {
+			_, _, err := rds.ExecuteUpdates([]SQLUpdate{{SQL: sql}})
+			return err
+		}
+	}
+	var outerErr error
+	err := rds.ExecuteFunctions([]func() error{
+		update("INSERT INTO t VALUES (1)"),
+		func() error {
+			// The outer unit of work carries on after the inner one fails.
+			innerErr := rds.ExecuteFunctions([]func() error{
+				update("INSERT INTO t VALUES (2)"),
+				func() error { return assert.AnError },
+			})
+			assert.ErrorIs(t, innerErr, assert.AnError)
+			return nil
+		},
+		func() error {
+			outerErr = update("INSERT INTO t VALUES (3)")()
+			return outerErr
+		},
+	})
+
+	assert.ErrorIs(t, outerErr, sql.ErrTxDone)
+	assert.ErrorIs(t, err, sql.ErrTxDone)
+	assert.Equal(t, []string{
+		"c1 BEGIN",
+		"c1 INSERT INTO t VALUES (1) []",
+		"c1 INSERT INTO t VALUES (2) []",
+		"c1 ROLLBACK",
+	}, fdb.Events())
+	assert.Equal(t, 0, tmr.getNumTransactionManagers())
+}
+
+func TestInnerRollbackMakesOuterReleaseReportRollbackOnly(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	tmr := NewTransactionManagerRegistry(pool)
+	rds := NewRDSPooledConnection(pool, tmr)
+
+	err := rds.ExecuteFunctions([]func() error{
+		func() error {
+			_ = rds.ExecuteFunctions([]func() error{
+				func() error {
+					_, _, err := rds.ExecuteUpdates([]SQLUpdate{{SQL: "DELETE FROM t"}})
+					return err
+				},
+				func() error { return assert.AnError },
+			})
+			return nil // The inner error is swallowed.
+		},
+	})
+
+	assert.ErrorIs(t, err, ErrRollbackOnly)
+	assert.Equal(t, []string{"BEGIN", "DELETE FROM t []", "ROLLBACK"}, fdb.Statements())
+	assert.Equal(t, 0, tmr.getNumTransactionManagers())
+}
+
+func TestTransactionManagerBeginsOnlyOnFirstStatement(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	tmr := NewTransactionManagerRegistry(pool)
+	rds := NewRDSPooledConnection(pool, tmr)
+
+	assert.NoError(t, rds.ExecuteFunctions([]func() error{func() error { return nil }}))
+	assert.Empty(t, fdb.Events())
+
+	_, _, err := rds.ExecuteUpdates([]SQLUpdate{{SQL: "UPDATE t SET n = 1"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"UPDATE t SET n = 1 []"}, fdb.Statements())
+}
+
+func TestNestedRegistrationRollsBackToSavepoint(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	tmr := NewTransactionManagerRegistry(pool)
+	tmr.SetNestedTransactions(true)
+	rds := NewRDSPooledConnection(pool, tmr)
+
+	update := func(sql string) func() error {
+		return func() error {
+			_, _, err := rds.ExecuteUpdates([]SQLUpdate{{SQL: sql}})
+			return err
+		}
+	}
+	err := rds.ExecuteFunctions([]func() error{
+		update("INSERT INTO t VALUES (1)"),
+		func() error {
+			// The outer unit of work carries on after the inner one fails.
+			innerErr := rds.ExecuteFunctions([]func() error{
+				update("INSERT INTO t VALUES (2)"),
+				func() error { return assert.AnError },
+			})
+			assert.ErrorIs(t, innerErr, assert.AnError)
+			return nil
+		},
+		update("INSERT INTO t VALUES (3)"),
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"BEGIN",
+		"INSERT INTO t VALUES (1) []",
+		"SAVEPOINT sp_1 []",
+		"INSERT INTO t VALUES (2) []",
+		"ROLLBACK TO SAVEPOINT sp_1 []",
+		"INSERT INTO t VALUES (3) []",
+		"COMMIT",
+	}, fdb.Statements())
+	assert.Equal(t, 0, tmr.getNumTransactionManagers())
+}
+
+func TestNestedRegistrationReleasesSavepoint(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	tmr := NewTransactionManagerRegistry(pool)
+	tmr.SetNestedTransactions(true)
+	rds := NewRDSPooledConnection(pool, tmr)
+
+	tmr.Register()
+	tmr.Register()
+	_, _, err := rds.ExecuteUpdates([]SQLUpdate{{SQL: "INSERT INTO t VALUES (1)"}})
+	assert.NoError(t, err)
+	assert.NoError(t, tmr.Release(true))
+	assert.Equal(t, 1, tmr.getTrackerCount(utils.GetGoroutineID()))
+
+	// A savepoint level without statements never reaches the server.
+	tmr.Register()
+	assert.NoError(t, tmr.Release(false))
+	assert.NoError(t, tmr.Release(true))
+
+	assert.Equal(t, []string{
+		"BEGIN",
+		"SAVEPOINT sp_1 []",
+		"INSERT INTO t VALUES (1) []",
+		"RELEASE SAVEPOINT sp_1 []",
+		"COMMIT",
+	}, fdb.Statements())
+}
+
+func TestExecuteFunctionsWithOptionsBeginsWithIsolationAndReadOnly(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	tmr := NewTransactionManagerRegistry(pool)
+	rds := NewRDSPooledConnection(pool, tmr)
+
+	opts := TxOptions{Isolation: sql.LevelSerializable, ReadOnly: true}
+	err := rds.ExecuteFunctionsWithOptions(opts, []func() error{func() error {
+		_, err := rds.ExecuteQuery("SELECT 1", nil, true)
+		return err
+	}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"BEGIN Serializable READ ONLY", "SELECT 1 []", "COMMIT"}, fdb.Statements())
+}
+
+func TestRegisterWithOptionsRejectsStrongerNestedIsolation(t *testing.T) {
+	pool, _ := newFakePool(t)
+	tmr := NewTransactionManagerRegistry(pool)
+
+	assert.NoError(t, tmr.RegisterWithOptions(TxOptions{Isolation: sql.LevelReadCommitted}))
+	assert.ErrorIs(t, tmr.RegisterWithOptions(TxOptions{Isolation: sql.LevelSerializable}), ErrIncompatibleIsolation)
+	assert.Equal(t, 1, tmr.getTrackerCount(utils.GetGoroutineID()))
+
+	// Weaker or unspecified isolation joins the outer transaction.
+	assert.NoError(t, tmr.RegisterWithOptions(TxOptions{Isolation: sql.LevelReadUncommitted}))
+	tmr.Register()
+	assert.Equal(t, 3, tmr.getTrackerCount(utils.GetGoroutineID()))
+
+	assert.NoError(t, tmr.Release(false))
+}
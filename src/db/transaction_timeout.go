@@ -0,0 +1,208 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anmollp/generic-db-go/src/utils"
+)
+
+// ErrTransactionTimeout is returned by statements and Release once a registered
+// transaction has outlived the registry's transaction timeout and been rolled back.
+var ErrTransactionTimeout = errors.New("transaction timed out and was rolled back")
+
+// registration records when and from where a TransactionManager was registered.
+type registration struct {
+	goroutineID int
+	at          time.Time
+	callers     []uintptr
+	reported    bool
+}
+
+func newRegistration(goroutineID int) registration {
+	callers := make([]uintptr, 32)
+	// Skip runtime.Callers, newRegistration and TransactionManagerRegistry.register.
+	n := runtime.Callers(3, callers)
+	return registration{goroutineID: goroutineID, at: time.Now(), callers: callers[:n]}
+}
+
+// site formats the stack the transaction was registered from.
+func (reg registration) site() string {
+	var site strings.Builder
+	frames := runtime.CallersFrames(reg.callers)
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&site, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return site.String()
+}
+
+// TransactionInfo describes a transaction currently registered in a TransactionManagerRegistry.
+type TransactionInfo struct {
+	GoroutineID  int
+	RegisteredAt time.Time
+	Age          time.Duration
+	Depth        int    // Number of unreleased Register calls.
+	TimedOut     bool   // Rolled back by the transaction timeout but not yet released.
+	Site         string // Stack the transaction was registered from.
+}
+
+// SetTransactionTimeout sets how long a transaction registered from now on may stay
+// open. Once it elapses the transaction is rolled back and its connection returned to
+// the pool; later statements and the final Release fail with ErrTransactionTimeout.
+// Zero, the default, disables the timeout.
+func (r *TransactionManagerRegistry) SetTransactionTimeout(timeout time.Duration) {
+	r.timeout = timeout
+}
+
+// OpenTransactions lists the transactions currently registered, oldest first.
+func (r *TransactionManagerRegistry) OpenTransactions() []TransactionInfo {
+	var infos []TransactionInfo
+	now := time.Now()
+	r.txManagers.Range(func(key, value interface{}) bool {
+		txManager := value.(*TransactionManager)
+		txManager.mu.Lock()
+		reg, timedOut := txManager.registration, txManager.timedOut
+		txManager.mu.Unlock()
+
+		infos = append(infos, TransactionInfo{
+			GoroutineID:  key.(int),
+			RegisteredAt: reg.at,
+			Age:          now.Sub(reg.at),
+			Depth:        r.getTrackerCount(key.(int)),
+			TimedOut:     timedOut,
+			Site:         reg.site(),
+		})
+		return true
+	})
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].RegisteredAt.Before(infos[j].RegisteredAt)
+	})
+	return infos
+}
+
+// StartLeakReaper starts a goroutine that checks the registry every interval and logs,
+// once per transaction, the registration stack of every transaction open for longer
+// than maxAge. Transactions rolled back by the transaction timeout more than maxAge ago
+// whose goroutine has exited without releasing them are removed from the registry. Call
+// the returned function to stop it; it returns once the goroutine has exited.
+func (r *TransactionManagerRegistry) StartLeakReaper(interval, maxAge time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-ticker.C:
+				r.reportLeaks(maxAge)
+				r.evictExpired(maxAge)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ticker.Stop()
+			close(done)
+		})
+		<-stopped
+	}
+}
+
+// reportLeaks logs the transactions open for longer than maxAge that were not reported yet.
+func (r *TransactionManagerRegistry) reportLeaks(maxAge time.Duration) {
+	r.txManagers.Range(func(key, value interface{}) bool {
+		txManager := value.(*TransactionManager)
+		txManager.mu.Lock()
+		leaked := !txManager.registration.reported && time.Since(txManager.registration.at) > maxAge
+		if leaked {
+			txManager.registration.reported = true
+		}
+		reg := txManager.registration
+		txManager.mu.Unlock()
+
+		if leaked {
+			log.Printf("Transaction on goroutine %d open for %v, registered at:\n%s",
+				key.(int), time.Since(reg.at).Round(time.Millisecond), reg.site())
+		}
+		return true
+	})
+}
+
+// evictExpired removes the transactions that timed out more than maxAge ago and whose
+// goroutine has exited, so can never release them. Those of goroutines still running
+// are kept: evicting them would let their next statements run autocommitted.
+func (r *TransactionManagerRegistry) evictExpired(maxAge time.Duration) {
+	var expired []int
+	r.txManagers.Range(func(key, value interface{}) bool {
+		txManager := value.(*TransactionManager)
+		txManager.mu.Lock()
+		if txManager.timedOut && time.Since(txManager.timedOutAt) > maxAge {
+			expired = append(expired, key.(int))
+		}
+		txManager.mu.Unlock()
+		return true
+	})
+	if len(expired) == 0 {
+		return
+	}
+
+	live := utils.GetLiveGoroutineIDs()
+	for _, goroutineID := range expired {
+		if live[goroutineID] {
+			continue
+		}
+		r.txManagers.Delete(goroutineID)
+		r.txTrackers.Delete(goroutineID)
+		log.Printf("Evicted timed out transaction of exited goroutine %d", goroutineID)
+	}
+}
+
+// startTimeout arranges for the transaction to be rolled back once timeout elapses.
+func (tm *TransactionManager) startTimeout(timeout time.Duration) {
+	tm.timeout = time.AfterFunc(timeout, tm.expire)
+}
+
+// stopTimeout cancels the pending timeout. The caller must hold tm.mu.
+func (tm *TransactionManager) stopTimeout() {
+	if tm.timeout != nil {
+		tm.timeout.Stop()
+		tm.timeout = nil
+	}
+}
+
+// expire rolls back a transaction that outlived its timeout and returns its connection to the pool.
+func (tm *TransactionManager) expire() {
+	tm.mu.Lock()
+	if tm.timeout == nil || tm.timedOut {
+		// The transaction ended while the timer was firing.
+		tm.mu.Unlock()
+		return
+	}
+	err := tm.rollbackLocked()
+	tm.closeConnection()
+	tm.timedOut = true
+	tm.timedOutAt = time.Now()
+	reg := tm.registration
+	tm.mu.Unlock()
+
+	if err != nil {
+		log.Printf("Failed to rollback timed out transaction: %v", err)
+	}
+	log.Printf("Rolled back transaction on goroutine %d after %v, registered at:\n%s",
+		reg.goroutineID, time.Since(reg.at).Round(time.Millisecond), reg.site())
+	tm.takeCallbacks().rolledBack(ErrTransactionTimeout)
+}
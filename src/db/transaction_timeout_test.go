@@ -0,0 +1,120 @@
+package db
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransactionTimeoutRollsBackAndFailsRelease(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	tmr := NewTransactionManagerRegistry(pool)
+	tmr.SetTransactionTimeout(50 * time.Millisecond)
+	rds := NewRDSPooledConnection(pool, tmr)
+
+	rolledBack := make(chan error, 1)
+	tmr.Register()
+	tmr.GetTransactionManager().OnRollback(func(err error) { rolledBack <- err })
+	assert.NoError(t, execUpdate(rds, "UPDATE t SET n = 1")())
+
+	select {
+	case err := <-rolledBack:
+		assert.ErrorIs(t, err, ErrTransactionTimeout)
+	case <-time.After(time.Second):
+		t.Fatal("transaction was not rolled back after its timeout")
+	}
+	assert.True(t, tmr.OpenTransactions()[0].TimedOut)
+	assert.Equal(t, []string{"BEGIN", "UPDATE t SET n = 1 []", "ROLLBACK"}, fdb.Statements())
+	assert.Equal(t, 0, pool.Stats().InUse)
+
+	assert.ErrorIs(t, execUpdate(rds, "UPDATE t SET n = 2")(), ErrTransactionTimeout)
+	assert.ErrorIs(t, tmr.Release(true), ErrTransactionTimeout)
+	assert.Empty(t, tmr.OpenTransactions())
+}
+
+func TestTransactionTimeoutStoppedByRelease(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	tmr := NewTransactionManagerRegistry(pool)
+	tmr.SetTransactionTimeout(20 * time.Millisecond)
+	rds := NewRDSPooledConnection(pool, tmr)
+
+	assert.NoError(t, rds.ExecuteFunctions([]func() error{execUpdate(rds, "UPDATE t SET n = 1")}))
+	time.Sleep(50 * time.Millisecond)
+
+	assert.Equal(t, []string{"BEGIN", "UPDATE t SET n = 1 []", "COMMIT"}, fdb.Statements())
+}
+
+func TestOpenTransactions(t *testing.T) {
+	pool, _ := newFakePool(t)
+	tmr := NewTransactionManagerRegistry(pool)
+
+	tmr.Register()
+	tmr.Register()
+	defer tmr.Release(false)
+
+	infos := tmr.OpenTransactions()
+	assert.Len(t, infos, 1)
+	assert.Equal(t, 2, infos[0].Depth)
+	assert.False(t, infos[0].TimedOut)
+	assert.Contains(t, infos[0].Site, "TestOpenTransactions")
+	assert.WithinDuration(t, time.Now(), infos[0].RegisteredAt, time.Second)
+}
+
+func TestLeakReaperLogsRegistrationSiteOnce(t *testing.T) {
+	pool, _ := newFakePool(t)
+	tmr := NewTransactionManagerRegistry(pool)
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	tmr.Register()
+	defer tmr.Release(false)
+	stop := tmr.StartLeakReaper(5*time.Millisecond, 0)
+	time.Sleep(50 * time.Millisecond)
+	stop()
+
+	output := logs.String()
+	assert.Equal(t, 1, strings.Count(output, "open for"))
+	assert.Contains(t, output, "TestLeakReaperLogsRegistrationSiteOnce")
+}
+
+func TestLeakReaperEvictsTimedOutTransactionsOfExitedGoroutines(t *testing.T) {
+	pool, _ := newFakePool(t)
+	tmr := NewTransactionManagerRegistry(pool)
+	tmr.SetTransactionTimeout(10 * time.Millisecond)
+	rds := NewRDSPooledConnection(pool, tmr)
+
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		tmr.Register() // Leaked: never released.
+		assert.NoError(t, execUpdate(rds, "UPDATE t SET n = 1")())
+	}()
+	<-exited
+	assert.Len(t, tmr.OpenTransactions(), 1)
+
+	stop := tmr.StartLeakReaper(5*time.Millisecond, 20*time.Millisecond)
+	defer stop()
+	assert.Eventually(t, func() bool { return len(tmr.OpenTransactions()) == 0 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, 0, tmr.getNumTransactionManagerTrackers())
+	assert.Equal(t, 0, pool.Stats().InUse)
+}
+
+func TestLeakReaperKeepsTimedOutTransactionsOfRunningGoroutines(t *testing.T) {
+	pool, _ := newFakePool(t)
+	tmr := NewTransactionManagerRegistry(pool)
+	tmr.SetTransactionTimeout(10 * time.Millisecond)
+
+	tmr.Register()
+	assert.Eventually(t, func() bool { return tmr.OpenTransactions()[0].TimedOut }, time.Second, 5*time.Millisecond)
+	tmr.evictExpired(0)
+
+	assert.Len(t, tmr.OpenTransactions(), 1)
+	assert.ErrorIs(t, tmr.Release(true), ErrTransactionTimeout)
+}
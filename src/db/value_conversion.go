@@ -0,0 +1,195 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ColumnConverter converts a non-NULL value as scanned from a column into the value
+// ExecuteQuery returns for it.
+type ColumnConverter func(value interface{}) (interface{}, error)
+
+// TypeMapping maps database type names, as reported by sql.ColumnType.DatabaseTypeName
+// (e.g. "VARCHAR", "DECIMAL", "JSON"), to the converters applied to their values.
+// Values of types without a converter are returned as the driver scanned them.
+type TypeMapping map[string]ColumnConverter
+
+// Decimal is an exact decimal number as MySQL formats it, e.g. "1234.50". It is kept as
+// text so that no precision is lost; use a decimal library for arithmetic.
+type Decimal string
+
+func (d Decimal) String() string {
+	return string(d)
+}
+
+// Float64 returns d as the nearest float64.
+func (d Decimal) Float64() (float64, error) {
+	return strconv.ParseFloat(string(d), 64)
+}
+
+// DefaultTypeMapping returns the mapping RDSPooledConnection starts with: text columns
+// become string, DATE, DATETIME and TIMESTAMP become time.Time in UTC, DECIMAL becomes
+// Decimal and JSON is decoded as by json.Unmarshal into an interface{}. Binary columns
+// stay []byte, TIME stays a string as it is a duration rather than a point in time,
+// and TINYINT stays an int64 unless TinyIntToBool is added for it.
+func DefaultTypeMapping() TypeMapping {
+	mapping := TypeMapping{
+		"DATE":      convertTime,
+		"DATETIME":  convertTime,
+		"TIMESTAMP": convertTime,
+		"DECIMAL":   convertDecimal,
+		"JSON":      convertJSON,
+	}
+	for _, text := range []string{"CHAR", "VARCHAR", "TINYTEXT", "TEXT", "MEDIUMTEXT", "LONGTEXT", "ENUM", "SET", "TIME"} {
+		mapping[text] = convertString
+	}
+	return mapping
+}
+
+// TinyIntToBool converts TINYINT values to bool. The driver does not report display
+// widths, so adding it for "TINYINT" converts every TINYINT column, not only TINYINT(1).
+func TinyIntToBool(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case int64:
+		return v != 0, nil
+	case []byte:
+		n, err := strconv.ParseInt(string(v), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return n != 0, nil
+	}
+	return value, nil
+}
+
+// SetTypeMapping replaces the mapping ExecuteQuery and Cursor.Map convert values with.
+// A nil mapping returns values exactly as the driver scanned them. Call it before the
+// connection is shared between goroutines.
+func (r *RDSPooledConnection) SetTypeMapping(mapping TypeMapping) {
+	r.typeMapping = mapping
+}
+
+// rowMapper reads rows into maps from column name to converted value.
+type rowMapper struct {
+	columns    []string
+	converters []ColumnConverter
+}
+
+func newRowMapper(rows *sql.Rows, mapping TypeMapping) (*rowMapper, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	mapper := &rowMapper{columns: columns, converters: make([]ColumnConverter, len(columns))}
+	if len(mapping) == 0 {
+		return mapper, nil
+	}
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	for i, columnType := range columnTypes {
+		mapper.converters[i] = mapping[strings.ToUpper(columnType.DatabaseTypeName())]
+	}
+	return mapper, nil
+}
+
+// scan reads the current row.
+func (m *rowMapper) scan(rows *sql.Rows) (map[string]interface{}, error) {
+	rowData := make([]interface{}, len(m.columns))
+	rowPointers := make([]interface{}, len(m.columns))
+	for i := range rowData {
+		rowPointers[i] = &rowData[i]
+	}
+
+	if err := rows.Scan(rowPointers...); err != nil {
+		return nil, err
+	}
+
+	rowMap := make(map[string]interface{})
+	for i, colName := range m.columns {
+		value := rowData[i]
+		if converter := m.converters[i]; converter != nil && value != nil {
+			converted, err := converter(value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to convert column %s: %w", colName, err)
+			}
+			value = converted
+		}
+		rowMap[colName] = value
+	}
+	return rowMap, nil
+}
+
+func convertString(value interface{}) (interface{}, error) {
+	if b, ok := value.([]byte); ok {
+		return string(b), nil
+	}
+	return value, nil
+}
+
+// mysqlTimeLayouts are the layouts of DATE, DATETIME and TIMESTAMP values read
+// without the driver's parseTime option.
+var mysqlTimeLayouts = []string{"2006-01-02 15:04:05.999999999", "2006-01-02"}
+
+func convertTime(value interface{}) (interface{}, error) {
+	var text string
+	switch v := value.(type) {
+	case []byte:
+		text = string(v)
+	case string:
+		text = v
+	default:
+		return value, nil
+	}
+
+	if strings.HasPrefix(text, "0000-00-00") {
+		return time.Time{}, nil
+	}
+	var err error
+	for _, layout := range mysqlTimeLayouts {
+		var t time.Time
+		if t, err = time.ParseInLocation(layout, text, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+	return nil, err
+}
+
+func convertDecimal(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case []byte:
+		return Decimal(v), nil
+	case string:
+		return Decimal(v), nil
+	case float64:
+		return Decimal(strconv.FormatFloat(v, 'f', -1, 64)), nil
+	case int64:
+		return Decimal(strconv.FormatInt(v, 10)), nil
+	}
+	return value, nil
+}
+
+func convertJSON(value interface{}) (interface{}, error) {
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return value, nil
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, err
+	}
+	return decoded, nil
+}
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// typedRow makes the fake database return one row whose columns report the given types.
+func typedRow(fdb *fakeDatabase, types map[string]string, row map[string]driver.Value) {
+	fdb.columnTypes = types
+	fdb.onQuery = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		var columns []string
+		var values []driver.Value
+		for column, value := range row {
+			columns = append(columns, column)
+			values = append(values, value)
+		}
+		return columns, [][]driver.Value{values}, nil
+	}
+}
+
+func TestExecuteQueryConvertsByColumnType(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	typedRow(fdb, map[string]string{
+		"name":       "VARCHAR",
+		"price":      "DECIMAL",
+		"created_at": "DATETIME",
+		"born_on":    "DATE",
+		"attributes": "JSON",
+		"avatar":     "BLOB",
+		"active":     "TINYINT",
+		"nickname":   "VARCHAR",
+	}, map[string]driver.Value{
+		"name":       []byte("Ada"),
+		"price":      []byte("1234.50"),
+		"created_at": []byte("2024-01-02 03:04:05.5"),
+		"born_on":    []byte("1815-12-10"),
+		"attributes": []byte(`{"tags":["math"],"level":3}`),
+		"avatar":     []byte{0xff},
+		"active":     int64(1),
+		"nickname":   nil,
+	})
+
+	result, err := rds.ExecuteQuery("SELECT * FROM users", nil, true)
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"name":       "Ada",
+		"price":      Decimal("1234.50"),
+		"created_at": time.Date(2024, 1, 2, 3, 4, 5, 500000000, time.UTC),
+		"born_on":    time.Date(1815, 12, 10, 0, 0, 0, 0, time.UTC),
+		"attributes": map[string]interface{}{"tags": []interface{}{"math"}, "level": float64(3)},
+		"avatar":     []byte{0xff},
+		"active":     int64(1),
+		"nickname":   nil,
+	}, result)
+}
+
+func TestSetTypeMapping(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	typedRow(fdb, map[string]string{"active": "TINYINT", "name": "VARCHAR"},
+		map[string]driver.Value{"active": int64(1), "name": []byte("Ada")})
+
+	mapping := DefaultTypeMapping()
+	mapping["TINYINT"] = TinyIntToBool
+	rds.SetTypeMapping(mapping)
+	result, err := rds.ExecuteQuery("SELECT active, name FROM users", nil, true)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"active": true, "name": "Ada"}, result)
+
+	rds.SetTypeMapping(nil)
+	result, err = rds.ExecuteQuery("SELECT active, name FROM users", nil, true)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"active": int64(1), "name": []byte("Ada")}, result)
+}
+
+func TestExecuteQueryReportsConversionErrors(t *testing.T) {
+	pool, fdb := newFakePool(t)
+	rds := NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+	typedRow(fdb, map[string]string{"attributes": "JSON"},
+		map[string]driver.Value{"attributes": []byte("{")})
+
+	_, err := rds.ExecuteQuery("SELECT attributes FROM users", nil, false)
+
+	assert.ErrorContains(t, err, "failed to convert column attributes")
+}
+
+func TestDecimalFloat64(t *testing.T) {
+	f, err := Decimal("1234.50").Float64()
+	assert.NoError(t, err)
+	assert.Equal(t, 1234.5, f)
+}
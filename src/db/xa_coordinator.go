@@ -0,0 +1,484 @@
+package db
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// XADecision is the outcome the coordinator decided for a global transaction.
+type XADecision string
+
+const (
+	XACommit   XADecision = "commit"
+	XARollback XADecision = "rollback"
+)
+
+// ErrXAIncomplete is returned when the commit decision was logged but some branches
+// could not be committed; they stay prepared until Recover commits them.
+var ErrXAIncomplete = errors.New("xa transaction committed on some branches only")
+
+// XADecisionLog durably records commit decisions, so that Recover can tell in-doubt
+// branches of committed global transactions from those of aborted ones.
+type XADecisionLog interface {
+	// Record durably stores the decision for gtrid before any branch is committed.
+	Record(gtrid string, decision XADecision) error
+	// Lookup returns the decision recorded for gtrid, if any.
+	Lookup(gtrid string) (XADecision, bool, error)
+	// Forget drops gtrid once every branch has been resolved.
+	Forget(gtrid string) error
+}
+
+// FileDecisionLog is an XADecisionLog appending one line per event to a local file
+// and syncing it to disk before returning. The decisions not yet forgotten are also
+// kept in memory, and the file is rewritten with only those once none is left or
+// decisionLogCompactAfter have been forgotten since, so it does not grow without bound.
+type FileDecisionLog struct {
+	path      string
+	decisions map[string]XADecision // Read from the file on first use.
+	forgotten int                   // Forget lines appended since the file was last rewritten.
+	mu        sync.Mutex
+}
+
+// decisionLogCompactAfter is the number of forgotten decisions after which a
+// FileDecisionLog still holding other decisions is rewritten.
+const decisionLogCompactAfter = 1000
+
+// NewFileDecisionLog creates a FileDecisionLog stored at path.
+func NewFileDecisionLog(path string) *FileDecisionLog {
+	return &FileDecisionLog{path: path}
+}
+
+func (l *FileDecisionLog) Record(gtrid string, decision XADecision) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.load(); err != nil {
+		return err
+	}
+	if err := l.append(gtrid, string(decision)); err != nil {
+		return err
+	}
+	l.decisions[gtrid] = decision
+	return nil
+}
+
+func (l *FileDecisionLog) Forget(gtrid string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.load(); err != nil {
+		return err
+	}
+	if _, ok := l.decisions[gtrid]; !ok {
+		return nil
+	}
+	delete(l.decisions, gtrid)
+	if len(l.decisions) == 0 || l.forgotten+1 >= decisionLogCompactAfter {
+		return l.compact()
+	}
+	// A decision whose forget line is not written is harmless: Recover finds no branch
+	// of it left to resolve.
+	if err := l.append(gtrid, "forget"); err != nil {
+		return err
+	}
+	l.forgotten++
+	return nil
+}
+
+func (l *FileDecisionLog) Lookup(gtrid string) (XADecision, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.load(); err != nil {
+		return "", false, err
+	}
+	decision, found := l.decisions[gtrid]
+	return decision, found, nil
+}
+
+// load reads the decisions not yet forgotten from the file, unless already done.
+func (l *FileDecisionLog) load() error {
+	if l.decisions != nil {
+		return nil
+	}
+
+	decisions := map[string]XADecision{}
+	forgotten := 0
+	file, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		l.decisions = decisions
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open decision log: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if fields[1] == "forget" {
+			delete(decisions, fields[0])
+			forgotten++
+		} else {
+			decisions[fields[0]] = XADecision(fields[1])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read decision log: %w", err)
+	}
+	l.decisions, l.forgotten = decisions, forgotten
+	return nil
+}
+
+func (l *FileDecisionLog) append(gtrid, event string) error {
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open decision log: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := fmt.Fprintf(file, "%s %s\n", gtrid, event); err != nil {
+		return fmt.Errorf("failed to write decision log: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync decision log: %w", err)
+	}
+	return nil
+}
+
+// compact replaces the file with one holding only the decisions not yet forgotten.
+// The new file is synced before it is renamed over the old one, so a crash leaves
+// either file complete.
+func (l *FileDecisionLog) compact() error {
+	tmpPath := l.path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to compact decision log: %w", err)
+	}
+	writer := bufio.NewWriter(file)
+	for gtrid, decision := range l.decisions {
+		fmt.Fprintf(writer, "%s %s\n", gtrid, decision)
+	}
+	err = writer.Flush()
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, l.path)
+	}
+	if err == nil {
+		err = syncDir(filepath.Dir(l.path))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to compact decision log: %w", err)
+	}
+	l.forgotten = 0
+	return nil
+}
+
+// syncDir makes a rename in dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// xidPart matches the characters allowed in coordinator and participant names, which
+// end up quoted in XA statements.
+var xidPart = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,40}$`)
+
+// maxCoordinatorName bounds coordinator names so that gtrids, name-<UnixNano>-<counter>,
+// stay within MySQL's 64 bytes: 20 + 1 + 19 + 1 + 20 digits of a uint64 counter.
+const maxCoordinatorName = 20
+
+// XACoordinator runs units of work that write to several MySQL servers as one global
+// XA transaction, committing every branch or none using two-phase commit.
+type XACoordinator struct {
+	name         string
+	participants map[string]*RDSPooledConnection
+	decisionLog  XADecisionLog
+	counter      uint64
+	newGTRID     func() string
+}
+
+// NewXACoordinator creates a coordinator over participants, keyed by a name used as the
+// branch qualifier of their XIDs. name, at most 20 characters, prefixes every global
+// transaction id the coordinator creates, so Recover only resolves its own
+// transactions; coordinators sharing servers must use different names. decisionLog
+// must not be nil.
+func NewXACoordinator(name string, participants map[string]*RDSPooledConnection, decisionLog XADecisionLog) (*XACoordinator, error) {
+	if decisionLog == nil {
+		return nil, errors.New("xa coordinator needs a decision log")
+	}
+	if !xidPart.MatchString(name) || len(name) > maxCoordinatorName {
+		return nil, fmt.Errorf("invalid xa coordinator name %q, at most %d characters of [A-Za-z0-9_.-] are allowed", name, maxCoordinatorName)
+	}
+	for participant := range participants {
+		if !xidPart.MatchString(participant) {
+			return nil, fmt.Errorf("invalid xa participant name %q", participant)
+		}
+	}
+
+	c := &XACoordinator{
+		name:         name,
+		participants: participants,
+		decisionLog:  decisionLog,
+	}
+	c.newGTRID = func() string {
+		return fmt.Sprintf("%s-%d-%d", c.name, time.Now().UnixNano(), atomic.AddUint64(&c.counter, 1))
+	}
+	return c, nil
+}
+
+// xaBranch is one participant's branch of a global transaction, pinned to a connection.
+type xaBranch struct {
+	participant string
+	xid         string
+	conn        *sql.Conn
+	failed      bool       // XA COMMIT or XA ROLLBACK failed, so the branch may still be prepared on conn.
+	mu          sync.Mutex // Serializes statements on conn.
+}
+
+// close returns the branch's connection to the pool, or discards it if the branch
+// failed: MySQL rejects ordinary statements with XAER_RMFAIL on a connection still
+// holding a prepared branch.
+func (b *xaBranch) close() {
+	if b.failed {
+		_ = b.conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	}
+	_ = b.conn.Close()
+}
+
+type xaContextKey struct{}
+
+// xaBranchFromContext returns r's branch of the XA transaction carried by ctx, if any.
+func xaBranchFromContext(ctx context.Context, r *RDSPooledConnection) (*xaBranch, bool) {
+	branches, ok := ctx.Value(xaContextKey{}).(map[*RDSPooledConnection]*xaBranch)
+	if !ok {
+		return nil, false
+	}
+	branch, ok := branches[r]
+	return branch, ok
+}
+
+// quoteXID formats an XID for XA statements. Both parts are generated from validated names.
+func quoteXID(gtrid, bqual string) string {
+	return fmt.Sprintf("'%s','%s'", gtrid, bqual)
+}
+
+// participantNames returns the participant names in a stable order.
+func (c *XACoordinator) participantNames() []string {
+	names := make([]string, 0, len(c.participants))
+	for name := range c.participants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Execute runs fn as one global XA transaction across all participants. Statements fn
+// runs through a participant's ExecuteQueryContext or ExecuteUpdatesContext, with the
+// context it is given, run in that participant's branch. If fn succeeds every branch is
+// prepared, the commit decision is logged and every branch is committed; if fn or any
+// prepare fails every branch is rolled back. A panic in fn is rethrown after rolling back.
+func (c *XACoordinator) Execute(ctx context.Context, fn func(ctx context.Context) error) error {
+	gtrid := c.newGTRID()
+	branches := make(map[*RDSPooledConnection]*xaBranch, len(c.participants))
+	var started []*xaBranch
+	defer func() {
+		for _, branch := range started {
+			branch.close()
+		}
+	}()
+
+	for _, name := range c.participantNames() {
+		rds := c.participants[name]
+		conn, err := rds.cnxPool.Conn(ctx)
+		if err != nil {
+			c.rollbackBranches(started)
+			return fmt.Errorf("failed to get connection for xa participant %s: %w", name, err)
+		}
+		branch := &xaBranch{participant: name, xid: quoteXID(gtrid, name), conn: conn}
+		if _, err := conn.ExecContext(ctx, "XA START "+branch.xid); err != nil {
+			conn.Close()
+			c.rollbackBranches(started)
+			return fmt.Errorf("failed to start xa branch on %s: %w", name, err)
+		}
+		started = append(started, branch)
+		branches[rds] = branch
+	}
+
+	if err := c.runBranches(context.WithValue(ctx, xaContextKey{}, branches), started, fn); err != nil {
+		return err
+	}
+
+	for _, phase := range []struct{ statement, verb string }{{"XA END ", "end"}, {"XA PREPARE ", "prepare"}} {
+		for _, branch := range started {
+			if _, err := branch.conn.ExecContext(ctx, phase.statement+branch.xid); err != nil {
+				c.rollbackBranches(started)
+				return fmt.Errorf("failed to %s xa branch on %s: %w", phase.verb, branch.participant, err)
+			}
+		}
+	}
+
+	// Logging the decision is the commit point: from here on Recover commits every branch.
+	if err := c.decisionLog.Record(gtrid, XACommit); err != nil {
+		c.rollbackBranches(started)
+		return fmt.Errorf("failed to record xa commit decision: %w", err)
+	}
+
+	var commitErrs []error
+	for _, branch := range started {
+		// Phase two must finish even if ctx has been cancelled meanwhile.
+		if _, err := branch.conn.ExecContext(context.Background(), "XA COMMIT "+branch.xid); err != nil {
+			branch.failed = true
+			commitErrs = append(commitErrs, fmt.Errorf("failed to commit xa branch on %s: %w", branch.participant, err))
+		}
+	}
+	if len(commitErrs) > 0 {
+		return fmt.Errorf("%w: %w", ErrXAIncomplete, errors.Join(commitErrs...))
+	}
+
+	if err := c.decisionLog.Forget(gtrid); err != nil {
+		log.Printf("Failed to forget xa transaction %s: %v", gtrid, err)
+	}
+	return nil
+}
+
+// runBranches runs fn, rolling every branch back if it fails or panics.
+func (c *XACoordinator) runBranches(ctx context.Context, branches []*xaBranch, fn func(ctx context.Context) error) error {
+	defer func() {
+		if rec := recover(); rec != nil {
+			c.rollbackBranches(branches)
+			panic(rec)
+		}
+	}()
+
+	if err := fn(ctx); err != nil {
+		c.rollbackBranches(branches)
+		return err
+	}
+	return nil
+}
+
+// rollbackBranches rolls back branches in any state. XA END fails harmlessly for
+// branches that were already ended or prepared.
+func (c *XACoordinator) rollbackBranches(branches []*xaBranch) {
+	for _, branch := range branches {
+		_, _ = branch.conn.ExecContext(context.Background(), "XA END "+branch.xid)
+		if _, err := branch.conn.ExecContext(context.Background(), "XA ROLLBACK "+branch.xid); err != nil {
+			branch.failed = true
+			log.Printf("Failed to rollback xa branch on %s: %v", branch.participant, err)
+		}
+	}
+}
+
+// XARecovered describes an in-doubt branch resolved by Recover.
+type XARecovered struct {
+	Participant string
+	GTRID       string
+	Decision    XADecision
+}
+
+// Recover resolves the branches of this coordinator's global transactions that a crash
+// left prepared. Each one listed by XA RECOVER is committed if the decision log recorded
+// a commit for it and rolled back otherwise. Run it at start-up, before Execute is
+// called, since a transaction still between prepare and logging its decision would be
+// rolled back.
+func (c *XACoordinator) Recover(ctx context.Context) ([]XARecovered, error) {
+	var resolved []XARecovered
+	var errs []error
+	committed := map[string]bool{}
+
+	for _, name := range c.participantNames() {
+		rds := c.participants[name]
+		xids, err := c.inDoubt(ctx, rds)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to list in-doubt xa branches on %s: %w", name, err))
+			continue
+		}
+
+		for _, xid := range xids {
+			decision, found, err := c.decisionLog.Lookup(xid[0])
+			if err != nil {
+				return resolved, err
+			}
+			if !found || decision != XACommit {
+				decision = XARollback
+			}
+
+			statement := "XA ROLLBACK "
+			if decision == XACommit {
+				statement = "XA COMMIT "
+			}
+			if _, err := rds.cnxPool.ExecContext(ctx, statement+quoteXID(xid[0], xid[1])); err != nil {
+				errs = append(errs, fmt.Errorf("failed to %s xa branch %s on %s: %w", decision, xid[0], name, err))
+				continue
+			}
+			if decision == XACommit {
+				committed[xid[0]] = true
+			}
+			resolved = append(resolved, XARecovered{Participant: name, GTRID: xid[0], Decision: decision})
+		}
+	}
+
+	if len(errs) > 0 {
+		return resolved, errors.Join(errs...)
+	}
+	for gtrid := range committed {
+		if err := c.decisionLog.Forget(gtrid); err != nil {
+			return resolved, err
+		}
+	}
+	return resolved, nil
+}
+
+// inDoubt returns the gtrid and bqual of every prepared branch of this coordinator on rds.
+func (c *XACoordinator) inDoubt(ctx context.Context, rds *RDSPooledConnection) ([][2]string, error) {
+	rows, err := rds.cnxPool.QueryContext(ctx, "XA RECOVER")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var xids [][2]string
+	for rows.Next() {
+		var formatID, gtridLength, bqualLength int64
+		var data []byte
+		if err := rows.Scan(&formatID, &gtridLength, &bqualLength, &data); err != nil {
+			return nil, err
+		}
+		if gtridLength+bqualLength > int64(len(data)) {
+			continue
+		}
+		gtrid := string(data[:gtridLength])
+		if !strings.HasPrefix(gtrid, c.name+"-") {
+			continue
+		}
+		xids = append(xids, [2]string{gtrid, string(data[gtridLength : gtridLength+bqualLength])})
+	}
+	return xids, rows.Err()
+}
@@ -0,0 +1,215 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newXATest returns a coordinator named "app" over two fake participants, "orders" and
+// "stock", whose global transaction ids are always "app-1".
+func newXATest(t *testing.T) (*XACoordinator, *FileDecisionLog, map[string]*RDSPooledConnection, map[string]*fakeDatabase) {
+	t.Helper()
+	participants := map[string]*RDSPooledConnection{}
+	fdbs := map[string]*fakeDatabase{}
+	for _, name := range []string{"orders", "stock"} {
+		pool, fdb := newNamedFakePool(t, t.Name()+"/"+name)
+		participants[name] = NewRDSPooledConnection(pool, NewTransactionManagerRegistry(pool))
+		fdbs[name] = fdb
+	}
+
+	decisionLog := NewFileDecisionLog(filepath.Join(t.TempDir(), "xa.log"))
+	c, err := NewXACoordinator("app", participants, decisionLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.newGTRID = func() string { return "app-1" }
+	return c, decisionLog, participants, fdbs
+}
+
+func TestXAExecuteCommitsAllBranches(t *testing.T) {
+	c, decisionLog, participants, fdbs := newXATest(t)
+
+	err := c.Execute(context.Background(), func(ctx context.Context) error {
+		if _, _, err := participants["orders"].ExecuteUpdatesContext(ctx, []SQLUpdate{{SQL: "INSERT INTO orders VALUES (1)"}}); err != nil {
+			return err
+		}
+		_, _, err := participants["stock"].ExecuteUpdatesContext(ctx, []SQLUpdate{{SQL: "UPDATE stock SET n = n - 1"}})
+		return err
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"XA START 'app-1','orders' []",
+		"INSERT INTO orders VALUES (1) []",
+		"XA END 'app-1','orders' []",
+		"XA PREPARE 'app-1','orders' []",
+		"XA COMMIT 'app-1','orders' []",
+	}, fdbs["orders"].Statements())
+	assert.Equal(t, []string{
+		"XA START 'app-1','stock' []",
+		"UPDATE stock SET n = n - 1 []",
+		"XA END 'app-1','stock' []",
+		"XA PREPARE 'app-1','stock' []",
+		"XA COMMIT 'app-1','stock' []",
+	}, fdbs["stock"].Statements())
+
+	_, found, err := decisionLog.Lookup("app-1")
+	assert.NoError(t, err)
+	assert.False(t, found, "decision should be forgotten once every branch committed")
+}
+
+func TestXAExecuteRollsBackWhenFunctionFails(t *testing.T) {
+	c, decisionLog, _, fdbs := newXATest(t)
+	failure := errors.New("out of stock")
+
+	err := c.Execute(context.Background(), func(ctx context.Context) error { return failure })
+
+	assert.ErrorIs(t, err, failure)
+	assert.Equal(t, []string{
+		"XA START 'app-1','stock' []",
+		"XA END 'app-1','stock' []",
+		"XA ROLLBACK 'app-1','stock' []",
+	}, fdbs["stock"].Statements())
+	_, found, _ := decisionLog.Lookup("app-1")
+	assert.False(t, found)
+}
+
+func TestXAExecuteRollsBackWhenPrepareFails(t *testing.T) {
+	c, decisionLog, _, fdbs := newXATest(t)
+	fdbs["stock"].onExec = func(query string, args []driver.Value) (driver.Result, error) {
+		if query == "XA PREPARE 'app-1','stock'" {
+			return nil, errors.New("prepare failed")
+		}
+		return driver.RowsAffected(0), nil
+	}
+
+	err := c.Execute(context.Background(), func(ctx context.Context) error { return nil })
+
+	assert.ErrorContains(t, err, "failed to prepare xa branch on stock")
+	assert.Equal(t, []string{
+		"XA START 'app-1','orders' []",
+		"XA END 'app-1','orders' []",
+		"XA PREPARE 'app-1','orders' []",
+		"XA END 'app-1','orders' []",
+		"XA ROLLBACK 'app-1','orders' []",
+	}, fdbs["orders"].Statements())
+	_, found, _ := decisionLog.Lookup("app-1")
+	assert.False(t, found, "no decision may be logged when a prepare fails")
+}
+
+func TestXAExecuteReportsIncompleteCommit(t *testing.T) {
+	c, decisionLog, participants, fdbs := newXATest(t)
+	fdbs["stock"].onExec = func(query string, args []driver.Value) (driver.Result, error) {
+		if query == "XA COMMIT 'app-1','stock'" {
+			return nil, errors.New("connection lost")
+		}
+		return driver.RowsAffected(0), nil
+	}
+
+	err := c.Execute(context.Background(), func(ctx context.Context) error { return nil })
+
+	assert.ErrorIs(t, err, ErrXAIncomplete)
+	decision, found, _ := decisionLog.Lookup("app-1")
+	assert.True(t, found, "decision must be kept for Recover")
+	assert.Equal(t, XACommit, decision)
+	assert.Equal(t, 1, participants["orders"].cnxPool.Stats().Idle)
+	assert.Equal(t, 0, participants["stock"].cnxPool.Stats().OpenConnections,
+		"a connection that may hold a prepared branch must not return to the pool")
+}
+
+func TestXARecoverResolvesInDoubtBranches(t *testing.T) {
+	c, decisionLog, _, fdbs := newXATest(t)
+	assert.NoError(t, decisionLog.Record("app-7", XACommit))
+	for name, fdb := range fdbs {
+		name, bqual := name, int64(len(name))
+		fdb.onQuery = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+			return []string{"formatID", "gtrid_length", "bqual_length", "data"}, [][]driver.Value{
+				{int64(1), int64(5), bqual, []byte("app-7" + name)},
+				{int64(1), int64(5), bqual, []byte("app-8" + name)},
+				{int64(1), int64(7), bqual, []byte("other-1" + name)},
+			}, nil
+		}
+	}
+
+	resolved, err := c.Recover(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, []XARecovered{
+		{Participant: "orders", GTRID: "app-7", Decision: XACommit},
+		{Participant: "orders", GTRID: "app-8", Decision: XARollback},
+		{Participant: "stock", GTRID: "app-7", Decision: XACommit},
+		{Participant: "stock", GTRID: "app-8", Decision: XARollback},
+	}, resolved)
+	assert.Equal(t, []string{
+		"XA RECOVER []",
+		"XA COMMIT 'app-7','orders' []",
+		"XA ROLLBACK 'app-8','orders' []",
+	}, fdbs["orders"].Statements())
+	_, found, _ := decisionLog.Lookup("app-7")
+	assert.False(t, found)
+}
+
+func TestFileDecisionLogCompacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "xa.log")
+	decisionLog := NewFileDecisionLog(path)
+
+	// Forgetting the last pending decision empties the file.
+	assert.NoError(t, decisionLog.Record("app-1", XACommit))
+	assert.NoError(t, decisionLog.Forget("app-1"))
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Empty(t, content)
+
+	// With a decision pending the file is rewritten every decisionLogCompactAfter forgets.
+	assert.NoError(t, decisionLog.Record("app-2", XACommit))
+	for i := 0; i < decisionLogCompactAfter; i++ {
+		gtrid := fmt.Sprintf("app-%d", i+3)
+		assert.NoError(t, decisionLog.Record(gtrid, XACommit))
+		assert.NoError(t, decisionLog.Forget(gtrid))
+	}
+	content, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Less(t, strings.Count(string(content), "\n"), 10)
+
+	decision, found, err := NewFileDecisionLog(path).Lookup("app-2")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, XACommit, decision)
+	_, found, err = NewFileDecisionLog(path).Lookup("app-3")
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestNewXACoordinatorRejectsUnsafeNames(t *testing.T) {
+	decisionLog := NewFileDecisionLog(filepath.Join(t.TempDir(), "xa.log"))
+	_, err := NewXACoordinator("app'", nil, decisionLog)
+	assert.Error(t, err)
+
+	_, err = NewXACoordinator("app", map[string]*RDSPooledConnection{"a b": nil}, decisionLog)
+	assert.Error(t, err)
+}
+
+func TestXACoordinatorNameKeepsGTRIDWithinLimit(t *testing.T) {
+	decisionLog := NewFileDecisionLog(filepath.Join(t.TempDir(), "xa.log"))
+	c, err := NewXACoordinator(strings.Repeat("a", maxCoordinatorName), nil, decisionLog)
+	assert.NoError(t, err)
+	c.counter = math.MaxUint64 - 1
+	assert.LessOrEqual(t, len(c.newGTRID()), 64)
+
+	_, err = NewXACoordinator(strings.Repeat("a", maxCoordinatorName+1), nil, decisionLog)
+	assert.Error(t, err)
+}
+
+func TestNewXACoordinatorRequiresDecisionLog(t *testing.T) {
+	_, err := NewXACoordinator("app", nil, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,131 @@
+// Package dberrors classifies MySQL errors so callers can react to them without
+// matching driver error numbers themselves.
+//
+//	_, _, err := rds.ExecuteUpdates(updates)
+//	var dbErr *dberrors.Error
+//	if errors.Is(err, dberrors.ErrDuplicateKey) && errors.As(err, &dbErr) {
+//		log.Printf("update %d hit key %s", dbErr.Index, dbErr.Key)
+//	}
+package dberrors
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Kinds of database error, matched with errors.Is against an *Error or anything wrapping one.
+var (
+	ErrDuplicateKey        = errors.New("duplicate key")
+	ErrForeignKeyViolation = errors.New("foreign key violation")
+	ErrDeadlock            = errors.New("deadlock")
+	ErrLockTimeout         = errors.New("lock wait timeout")
+	ErrConnectionLost      = errors.New("connection lost")
+	ErrReadOnly            = errors.New("database is read-only")
+)
+
+// MySQL server and client error numbers, by kind.
+var kinds = map[uint16]error{
+	1062: ErrDuplicateKey,        // ER_DUP_ENTRY
+	1216: ErrForeignKeyViolation, // ER_NO_REFERENCED_ROW
+	1217: ErrForeignKeyViolation, // ER_ROW_IS_REFERENCED
+	1451: ErrForeignKeyViolation, // ER_ROW_IS_REFERENCED_2
+	1452: ErrForeignKeyViolation, // ER_NO_REFERENCED_ROW_2
+	1213: ErrDeadlock,            // ER_LOCK_DEADLOCK
+	1205: ErrLockTimeout,         // ER_LOCK_WAIT_TIMEOUT
+	1053: ErrConnectionLost,      // ER_SERVER_SHUTDOWN
+	1927: ErrConnectionLost,      // ER_CONNECTION_KILLED
+	2006: ErrConnectionLost,      // CR_SERVER_GONE_ERROR
+	2013: ErrConnectionLost,      // CR_SERVER_LOST
+	1792: ErrReadOnly,            // ER_CANT_EXECUTE_IN_READ_ONLY_TRANSACTION
+	1836: ErrReadOnly,            // ER_READ_ONLY_MODE
+}
+
+// errOptionPrevents is ER_OPTION_PREVENTS_STATEMENT, which covers --read-only and
+// --super-read-only among other server options.
+const errOptionPrevents = 1290
+
+// duplicateKey extracts the key name from "Duplicate entry 'x' for key 'users.email'".
+var duplicateKey = regexp.MustCompile(`for key '([^']*)'$`)
+
+// Error is a classified database error together with the statement that caused it.
+type Error struct {
+	Kind  error  // One of the Err* kinds above.
+	SQL   string // The statement that failed.
+	Index int    // Position of the failed update in an ExecuteUpdates call; zero for queries.
+	Key   string // Name of the violated key, for ErrDuplicateKey.
+	Err   error  // The driver's error.
+}
+
+func (e *Error) Error() string {
+	kind := e.Kind.Error()
+	if e.Key != "" {
+		kind = fmt.Sprintf("%s %s", kind, e.Key)
+	}
+	return fmt.Sprintf("%s in statement %d (%s): %v", kind, e.Index, e.SQL, e.Err)
+}
+
+// Unwrap makes both the kind and the driver's error visible to errors.Is and errors.As.
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// Retryable reports whether running the statement's transaction again may succeed:
+// true for deadlocks and lock wait timeouts. A lost connection is not retryable, since
+// an autocommitted statement or a COMMIT may have taken effect before it was lost.
+func (e *Error) Retryable() bool {
+	return e.Kind == ErrDeadlock || e.Kind == ErrLockTimeout
+}
+
+// Classify wraps err in an *Error for sqlQuery and index if it is of a known kind, and
+// returns it unchanged otherwise, including when it is nil or already classified.
+func Classify(err error, sqlQuery string, index int) error {
+	if err == nil {
+		return nil
+	}
+	var dbErr *Error
+	if errors.As(err, &dbErr) {
+		return err
+	}
+	kind, key := classify(err)
+	if kind == nil {
+		return err
+	}
+	return &Error{Kind: kind, SQL: sqlQuery, Index: index, Key: key, Err: err}
+}
+
+// Retryable reports whether err, classified or not, is a deadlock or lock wait timeout.
+func Retryable(err error) bool {
+	var dbErr *Error
+	if errors.As(err, &dbErr) {
+		return dbErr.Retryable()
+	}
+	kind, _ := classify(err)
+	return kind == ErrDeadlock || kind == ErrLockTimeout
+}
+
+// classify returns the kind of err and, for duplicate keys, the key name.
+func classify(err error) (kind error, key string) {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) {
+		return ErrConnectionLost, ""
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return nil, ""
+	}
+	if mysqlErr.Number == errOptionPrevents && strings.Contains(mysqlErr.Message, "read-only") {
+		return ErrReadOnly, ""
+	}
+	kind = kinds[mysqlErr.Number]
+	if kind == ErrDuplicateKey {
+		if match := duplicateKey.FindStringSubmatch(mysqlErr.Message); match != nil {
+			key = match[1]
+		}
+	}
+	return kind, key
+}
@@ -0,0 +1,75 @@
+package dberrors
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyKinds(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		kind error
+	}{
+		{&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'a' for key 'email'"}, ErrDuplicateKey},
+		{&mysql.MySQLError{Number: 1452, Message: "Cannot add or update a child row"}, ErrForeignKeyViolation},
+		{&mysql.MySQLError{Number: 1451, Message: "Cannot delete or update a parent row"}, ErrForeignKeyViolation},
+		{&mysql.MySQLError{Number: 1213, Message: "Deadlock found"}, ErrDeadlock},
+		{&mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"}, ErrLockTimeout},
+		{&mysql.MySQLError{Number: 1290, Message: "The MySQL server is running with the --read-only option"}, ErrReadOnly},
+		{&mysql.MySQLError{Number: 1792, Message: "Cannot execute statement in a READ ONLY transaction."}, ErrReadOnly},
+		{mysql.ErrInvalidConn, ErrConnectionLost},
+		{fmt.Errorf("failed to commit: %w", driver.ErrBadConn), ErrConnectionLost},
+	} {
+		err := Classify(tc.err, "INSERT INTO t VALUES (?)", 2)
+
+		var dbErr *Error
+		if assert.ErrorAs(t, err, &dbErr, tc.err.Error()) {
+			assert.Equal(t, tc.kind, dbErr.Kind)
+			assert.Equal(t, "INSERT INTO t VALUES (?)", dbErr.SQL)
+			assert.Equal(t, 2, dbErr.Index)
+		}
+		assert.ErrorIs(t, err, tc.kind)
+		assert.ErrorIs(t, err, tc.err)
+	}
+}
+
+func TestClassifyLeavesOtherErrorsAlone(t *testing.T) {
+	assert.Nil(t, Classify(nil, "SELECT 1", 0))
+
+	other := &mysql.MySQLError{Number: 1064, Message: "You have an error in your SQL syntax"}
+	assert.Same(t, other, Classify(other, "SELEC 1", 0))
+
+	secureFile := &mysql.MySQLError{Number: 1290, Message: "The MySQL server is running with the --secure-file-priv option"}
+	assert.Same(t, secureFile, Classify(secureFile, "SELECT 1 INTO OUTFILE 'x'", 0))
+
+	classified := Classify(&mysql.MySQLError{Number: 1213}, "UPDATE t SET n = 1", 3)
+	wrapped := fmt.Errorf("failed to commit: %w", classified)
+	assert.Same(t, wrapped, Classify(wrapped, "COMMIT", 0), "already classified errors keep their statement")
+}
+
+func TestDuplicateKeyName(t *testing.T) {
+	err := Classify(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'ada@example.com' for key 'users.email'"}, "INSERT INTO users (email) VALUES (?)", 1)
+
+	var dbErr *Error
+	assert.ErrorAs(t, err, &dbErr)
+	assert.Equal(t, "users.email", dbErr.Key)
+	assert.EqualError(t, err, "duplicate key users.email in statement 1 (INSERT INTO users (email) VALUES (?)): "+
+		"Error 1062: Duplicate entry 'ada@example.com' for key 'users.email'")
+}
+
+func TestRetryable(t *testing.T) {
+	deadlock := &mysql.MySQLError{Number: 1213}
+	assert.True(t, Retryable(deadlock))
+	assert.True(t, Retryable(Classify(&mysql.MySQLError{Number: 1205}, "UPDATE t SET n = 1", 0)))
+	assert.True(t, Classify(deadlock, "UPDATE t SET n = 1", 0).(*Error).Retryable())
+
+	assert.False(t, Retryable(Classify(mysql.ErrInvalidConn, "COMMIT", 0)))
+	assert.False(t, Retryable(Classify(&mysql.MySQLError{Number: 1062}, "INSERT INTO t VALUES (1)", 0)))
+	assert.False(t, Retryable(errors.New("boom")))
+	assert.False(t, Retryable(nil))
+}
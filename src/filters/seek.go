@@ -0,0 +1,87 @@
+package filters
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SortColumn is one column of a sort order.
+type SortColumn struct {
+	Column     string
+	Descending bool
+}
+
+// Seek matches the rows that come after Values in the order given by Columns, for
+// keyset pagination. Columns sorted in one direction compare as a row value, e.g.
+// "(created_at, id) > (?, ?)"; mixed directions expand to
+// "(created_at < ? OR (created_at = ? AND id > ?))". Sort columns must not be NULL.
+type Seek struct {
+	Columns []SortColumn
+	Values  []interface{}
+}
+
+func (s Seek) GetSQL() string {
+	if len(s.Columns) == 0 {
+		return "true"
+	}
+
+	if s.uniformDirection() {
+		op := operator(s.Columns[0])
+		if len(s.Columns) == 1 {
+			return fmt.Sprintf("%s %s ?", s.Columns[0].Column, op)
+		}
+		columns := make([]string, len(s.Columns))
+		for i, column := range s.Columns {
+			columns[i] = column.Column
+		}
+		placeholders := strings.Repeat("?, ", len(s.Columns)-1) + "?"
+		return fmt.Sprintf("(%s) %s (%s)", strings.Join(columns, ", "), op, placeholders)
+	}
+
+	var terms []string
+	for i, column := range s.Columns {
+		var conditions []string
+		for _, previous := range s.Columns[:i] {
+			conditions = append(conditions, previous.Column+" = ?")
+		}
+		conditions = append(conditions, fmt.Sprintf("%s %s ?", column.Column, operator(column)))
+		term := strings.Join(conditions, " AND ")
+		if i > 0 {
+			term = "(" + term + ")"
+		}
+		terms = append(terms, term)
+	}
+	return "(" + strings.Join(terms, " OR ") + ")"
+}
+
+func (s Seek) GetParams() []interface{} {
+	if len(s.Columns) == 0 {
+		return nil
+	}
+	if s.uniformDirection() {
+		return append([]interface{}(nil), s.Values...)
+	}
+
+	var params []interface{}
+	for i := range s.Columns {
+		params = append(params, s.Values[:i+1]...)
+	}
+	return params
+}
+
+func (s Seek) uniformDirection() bool {
+	for _, column := range s.Columns[1:] {
+		if column.Descending != s.Columns[0].Descending {
+			return false
+		}
+	}
+	return true
+}
+
+// operator returns the comparison selecting the values after a given one in column's order.
+func operator(column SortColumn) string {
+	if column.Descending {
+		return "<"
+	}
+	return ">"
+}
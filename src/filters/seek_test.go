@@ -0,0 +1,61 @@
+package filters
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSeekFilter_RowValue(t *testing.T) {
+	seekFilter := Seek{
+		Columns: []SortColumn{{Column: "created_at"}, {Column: "id"}},
+		Values:  []interface{}{"2024-01-02", 7},
+	}
+	expectedSQL := "(created_at, id) > (?, ?)"
+	actualSQL := seekFilter.GetSQL()
+	if expectedSQL != actualSQL {
+		t.Errorf("GetSQL() failed. Expected: %s, Got: %s", expectedSQL, actualSQL)
+	}
+	expectedParams := []interface{}{"2024-01-02", 7}
+	actualParams := seekFilter.GetParams()
+	if !reflect.DeepEqual(expectedParams, actualParams) {
+		t.Errorf("GetParams() failed. Expected: %v, Got: %v", expectedParams, actualParams)
+	}
+}
+
+func TestSeekFilter_Descending(t *testing.T) {
+	seekFilter := Seek{Columns: []SortColumn{{Column: "id", Descending: true}}, Values: []interface{}{7}}
+	expectedSQL := "id < ?"
+	actualSQL := seekFilter.GetSQL()
+	if expectedSQL != actualSQL {
+		t.Errorf("GetSQL() failed. Expected: %s, Got: %s", expectedSQL, actualSQL)
+	}
+}
+
+func TestSeekFilter_MixedDirections(t *testing.T) {
+	seekFilter := Seek{
+		Columns: []SortColumn{{Column: "score", Descending: true}, {Column: "name"}, {Column: "id"}},
+		Values:  []interface{}{90, "ada", 7},
+	}
+	expectedSQL := "(score < ? OR (score = ? AND name > ?) OR (score = ? AND name = ? AND id > ?))"
+	actualSQL := seekFilter.GetSQL()
+	if expectedSQL != actualSQL {
+		t.Errorf("GetSQL() failed. Expected: %s, Got: %s", expectedSQL, actualSQL)
+	}
+	expectedParams := []interface{}{90, 90, "ada", 90, "ada", 7}
+	actualParams := seekFilter.GetParams()
+	if !reflect.DeepEqual(expectedParams, actualParams) {
+		t.Errorf("GetParams() failed. Expected: %v, Got: %v", expectedParams, actualParams)
+	}
+}
+
+func TestSeekFilter_EmptyColumns(t *testing.T) {
+	seekFilter := Seek{}
+	expectedSQL := "true"
+	actualSQL := seekFilter.GetSQL()
+	if expectedSQL != actualSQL {
+		t.Errorf("GetSQL() failed. Expected: %s, Got: %s", expectedSQL, actualSQL)
+	}
+	if params := seekFilter.GetParams(); len(params) != 0 {
+		t.Errorf("GetParams() failed. Expected no params, Got: %v", params)
+	}
+}
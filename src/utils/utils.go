@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"bytes"
 	"fmt"
 	"runtime"
 )
@@ -13,3 +14,28 @@ func GetGoroutineID() int {
 	fmt.Sscanf(string(buf[:n]), "goroutine %d ", &goroutineID)
 	return goroutineID
 }
+
+// GetLiveGoroutineIDs Utility function to get the IDs of all goroutines currently running.
+func GetLiveGoroutineIDs() map[int]bool {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	ids := map[int]bool{}
+	for _, line := range bytes.Split(buf, []byte("\n")) {
+		if !bytes.HasPrefix(line, []byte("goroutine ")) {
+			continue
+		}
+		var goroutineID int
+		if _, err := fmt.Sscanf(string(line), "goroutine %d ", &goroutineID); err == nil {
+			ids[goroutineID] = true
+		}
+	}
+	return ids
+}